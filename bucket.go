@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+const allUsersURI = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+func bucketCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "bucket",
+		Usage: "管理存储桶",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "ls",
+				Usage: "查看存储桶列表",
+				Action: func(ctx *cli.Context) error {
+					return listBuckets(NewClient())
+				},
+			},
+			{
+				Name:      "create",
+				Usage:     "创建存储桶",
+				ArgsUsage: "<存储桶>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "acl",
+						Usage: "访问权限, private/public-read/public-read-write",
+						Value: string(oossdk.ACLPrivate),
+					},
+					&cli.StringFlag{
+						Name:     "meta-location",
+						Usage:    "元数据存储位置, 如 ChengDu",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:  "data-location",
+						Usage: "数据存储位置, 可指定多个, 不指定时就近存储",
+					},
+					&cli.BoolFlag{
+						Name:  "schedule",
+						Usage: "指定数据存储位置时, 允许在存储位置不可用时调度到其他位置",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					name, err := bucketArg(ctx)
+					if err != nil {
+						return err
+					}
+					acl := oossdk.ACLType(ctx.String("acl"))
+					switch acl {
+					case oossdk.ACLPrivate, oossdk.ACLPublicRead, oossdk.ACLPublicReadWrite:
+					default:
+						return cli.Exit(fmt.Sprintf("不支持的访问权限: %s", acl), 1)
+					}
+					var conf interface{}
+					if locations := ctx.StringSlice("data-location"); len(locations) > 0 {
+						conf, err = oossdk.BuildCreateBucketConfigSpecified(ctx.String("meta-location"), locations, ctx.Bool("schedule"))
+					} else {
+						conf, err = oossdk.BuildCreateBucketConfigLocal(ctx.String("meta-location"))
+					}
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					if err = NewClient().CreateBucket(name, conf, oossdk.ACL(acl)); err != nil {
+						return cli.Exit(err, 1)
+					}
+					fmt.Println("已创建存储桶", name)
+					return nil
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "删除存储桶, 存储桶须为空",
+				ArgsUsage: "<存储桶>",
+				Action: func(ctx *cli.Context) error {
+					name, err := bucketArg(ctx)
+					if err != nil {
+						return err
+					}
+					if err = NewClient().DeleteBucket(name); err != nil {
+						return cli.Exit(err, 1)
+					}
+					fmt.Println("已删除存储桶", name)
+					return nil
+				},
+			},
+			{
+				Name:      "info",
+				Usage:     "查看存储桶的访问权限、存储位置及可用区域",
+				ArgsUsage: "[存储桶]",
+				Action: func(ctx *cli.Context) error {
+					name, err := bucketArg(ctx)
+					if err != nil {
+						return err
+					}
+					return bucketInfo(NewClient(), name)
+				},
+			},
+			bucketConfigCmd(),
+		},
+	}
+}
+
+// bucketArg 取第一个参数作为存储桶名称, 未指定时使用--bucket
+func bucketArg(ctx *cli.Context) (string, error) {
+	if name := ctx.Args().First(); name != "" {
+		return name, nil
+	}
+	if name := ctx.String("bucket"); name != "" {
+		return name, nil
+	}
+	return "", cli.Exit("请指定存储桶", 1)
+}
+
+func listBuckets(client *oossdk.Client) error {
+	lbr, err := client.ListBuckets()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, bucket := range lbr.Buckets {
+		fmt.Fprintf(w, "%s\t%s\n", bucket.Name, bucket.CreationDate.Local().Format("2006-01-02 15:04:05"))
+	}
+	w.Flush()
+	fmt.Println("共", len(lbr.Buckets), "个存储桶")
+	return nil
+}
+
+// bucketACL 根据授权列表推断存储桶的访问权限
+func bucketACL(acl oossdk.GetBucketACLResult) oossdk.ACLType {
+	result := oossdk.ACLPrivate
+	for _, grant := range acl.GrantList {
+		if grant.GranteeURI != allUsersURI {
+			continue
+		}
+		switch grant.Permission {
+		case "WRITE", "FULL_CONTROL":
+			return oossdk.ACLPublicReadWrite
+		case "READ":
+			result = oossdk.ACLPublicRead
+		}
+	}
+	return result
+}
+
+func bucketInfo(client *oossdk.Client, name string) error {
+	acl, err := client.GetBucketACL(name)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	location, err := client.GetBucketLocation(name)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	regions, err := client.GetRegions()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Bucket\t%s\n", name)
+	fmt.Fprintf(w, "Owner\t%s\n", acl.Owner.DisplayName)
+	fmt.Fprintf(w, "ACL\t%s\n", bucketACL(acl))
+	fmt.Fprintf(w, "Metadata-Location\t%s\n", location.MetaLocation)
+	fmt.Fprintf(w, "Data-Location\t%s\n", location.DataLocationType)
+	if location.DataLocationType == oossdk.DataLocationTypeSpecified {
+		fmt.Fprintf(w, "Data-Location-List\t%s\n", strings.Join(location.DataLocationList, ", "))
+		fmt.Fprintf(w, "Schedule-Strategy\t%s\n", location.ScheduleStrategy)
+	}
+	fmt.Fprintf(w, "Metadata-Regions\t%s\n", strings.Join(regions.MetadataRegions, ", "))
+	fmt.Fprintf(w, "Data-Regions\t%s\n", strings.Join(regions.DataRegions, ", "))
+	return w.Flush()
+}
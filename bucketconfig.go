@@ -0,0 +1,561 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/pelletier/go-toml"
+	"github.com/urfave/cli/v2"
+)
+
+// bucketConfig 存储桶配置, 以TOML格式导出与应用. 除acl外, 文件中省略的部分表示未配置, 应用时会被删除
+type bucketConfig struct {
+	Bucket     string                `toml:"bucket,omitempty"`
+	ACL        string                `toml:"acl,omitempty"`
+	Policy     string                `toml:"policy,omitempty" multiline:"true" literal:"true"`
+	Logging    *loggingConfig        `toml:"logging,omitempty"`
+	Website    *websiteConfig        `toml:"website,omitempty"`
+	ObjectLock *objectLockConfig     `toml:"objectLock,omitempty"`
+	Lifecycle  []lifecycleRuleConfig `toml:"lifecycle,omitempty"`
+	CORS       []corsRuleConfig      `toml:"cors,omitempty"`
+}
+
+type loggingConfig struct {
+	TargetBucket string `toml:"targetBucket"`
+	TargetPrefix string `toml:"targetPrefix,omitempty"`
+}
+
+type websiteConfig struct {
+	IndexDocument         string              `toml:"indexDocument,omitempty"`
+	ErrorDocument         string              `toml:"errorDocument,omitempty"`
+	RedirectAllRequestsTo *redirectConfig     `toml:"redirectAllRequestsTo,omitempty"`
+	RoutingRules          []routingRuleConfig `toml:"routingRules,omitempty"`
+}
+
+type redirectConfig struct {
+	HostName string `toml:"hostName,omitempty"`
+	Protocol string `toml:"protocol,omitempty"`
+}
+
+type routingRuleConfig struct {
+	KeyPrefixEquals             string `toml:"keyPrefixEquals,omitempty"`
+	HttpErrorCodeReturnedEquals string `toml:"httpErrorCodeReturnedEquals,omitempty"`
+	HostName                    string `toml:"hostName,omitempty"`
+	Protocol                    string `toml:"protocol,omitempty"`
+	ReplaceKeyPrefixWith        string `toml:"replaceKeyPrefixWith,omitempty"`
+	ReplaceKeyWith              string `toml:"replaceKeyWith,omitempty"`
+}
+
+type objectLockConfig struct {
+	ObjectLockEnabled string `toml:"objectLockEnabled"`
+	Mode              string `toml:"mode"`
+	Days              int    `toml:"days,omitempty"`
+	Years             int    `toml:"years,omitempty"`
+}
+
+type lifecycleRuleConfig struct {
+	ID                     string `toml:"id,omitempty"`
+	Prefix                 string `toml:"prefix"`
+	Status                 string `toml:"status"`
+	ExpirationDays         int    `toml:"expirationDays,omitempty"`
+	ExpirationDate         string `toml:"expirationDate,omitempty"`
+	TransitionDays         int    `toml:"transitionDays,omitempty"`
+	TransitionDate         string `toml:"transitionDate,omitempty"`
+	TransitionStorageClass string `toml:"transitionStorageClass,omitempty"`
+}
+
+type corsRuleConfig struct {
+	AllowedOrigins []string `toml:"allowedOrigins"`
+	AllowedMethods []string `toml:"allowedMethods"`
+	AllowedHeaders []string `toml:"allowedHeaders,omitempty"`
+	ExposeHeaders  []string `toml:"exposeHeaders,omitempty"`
+	MaxAgeSeconds  int      `toml:"maxAgeSeconds,omitempty"`
+}
+
+// configSection 配置中可单独比较与应用的一部分
+type configSection struct {
+	name string
+	// pick 将src中本部分的配置复制到dst
+	pick func(src, dst *bucketConfig)
+	// apply 将本部分的配置应用到存储桶
+	apply func(client *oossdk.Client, bucket string, c *bucketConfig) error
+}
+
+var configSections = []configSection{
+	{
+		name: "acl",
+		pick: func(src, dst *bucketConfig) { dst.ACL = src.ACL },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			return client.SetBucketACL(bucket, oossdk.ACLType(c.ACL))
+		},
+	},
+	{
+		name: "policy",
+		pick: func(src, dst *bucketConfig) { dst.Policy = src.Policy },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			if c.Policy == "" {
+				return client.DeleteBucketPolicy(bucket)
+			}
+			return client.SetBucketPolicy(bucket, c.Policy)
+		},
+	},
+	{
+		name: "logging",
+		pick: func(src, dst *bucketConfig) { dst.Logging = src.Logging },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			if c.Logging == nil {
+				return client.SetBucketLogging(bucket, "", "", false)
+			}
+			return client.SetBucketLogging(bucket, c.Logging.TargetBucket, c.Logging.TargetPrefix, true)
+		},
+	},
+	{
+		name: "website",
+		pick: func(src, dst *bucketConfig) { dst.Website = src.Website },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			if c.Website == nil {
+				return client.DeleteBucketWebsite(bucket)
+			}
+			return client.SetBucketWebsite(bucket, c.Website.toSDK())
+		},
+	},
+	{
+		name: "objectLock",
+		pick: func(src, dst *bucketConfig) { dst.ObjectLock = src.ObjectLock },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			return client.SetBucketObjectLock(bucket, c.ObjectLock.toSDK())
+		},
+	},
+	{
+		name: "lifecycle",
+		pick: func(src, dst *bucketConfig) { dst.Lifecycle = src.Lifecycle },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			if len(c.Lifecycle) == 0 {
+				return client.DeleteBucketLifecycle(bucket)
+			}
+			rules := make([]oossdk.LifecycleRule, len(c.Lifecycle))
+			for i, rule := range c.Lifecycle {
+				rules[i] = rule.toSDK()
+			}
+			return client.SetBucketLifecycle(bucket, rules)
+		},
+	},
+	{
+		name: "cors",
+		pick: func(src, dst *bucketConfig) { dst.CORS = src.CORS },
+		apply: func(client *oossdk.Client, bucket string, c *bucketConfig) error {
+			if len(c.CORS) == 0 {
+				return client.DeleteBucketCors(bucket)
+			}
+			rules := make([]oossdk.CORSRule, len(c.CORS))
+			for i, rule := range c.CORS {
+				rules[i] = rule.toSDK()
+			}
+			return client.SetBucketCors(bucket, rules)
+		},
+	},
+}
+
+func bucketConfigCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "以TOML文件管理存储桶配置 (acl, policy, logging, website, objectLock, lifecycle, cors)",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "export",
+				Usage:     "导出存储桶配置到标准输出",
+				ArgsUsage: "[存储桶]",
+				Action: func(ctx *cli.Context) error {
+					name, err := bucketArg(ctx)
+					if err != nil {
+						return err
+					}
+					conf, err := exportBucketConfig(NewClient(), name)
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					data, err := marshalBucketConfig(conf)
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					os.Stdout.Write(data)
+					return nil
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "比较配置文件与存储桶的当前配置",
+				ArgsUsage: "<配置文件>",
+				Action: func(ctx *cli.Context) error {
+					return applyBucketConfig(ctx, true)
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "将配置文件应用到存储桶, 只修改有变更的部分",
+				ArgsUsage: "<配置文件>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "plan",
+						Usage: "只显示变更, 不应用",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return applyBucketConfig(ctx, ctx.Bool("plan"))
+				},
+			},
+		},
+	}
+}
+
+// applyBucketConfig 显示配置文件与当前配置的差异, plan为false时应用变更
+func applyBucketConfig(ctx *cli.Context, plan bool) error {
+	file := ctx.Args().First()
+	if file == "" {
+		return cli.Exit("请指定配置文件", 1)
+	}
+	desired, err := loadBucketConfig(file)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if bucket := ctx.String("bucket"); bucket != "" {
+		if desired.Bucket != "" && desired.Bucket != bucket {
+			return cli.Exit(fmt.Sprintf("配置文件中的bucket %s 与--bucket %s 不一致", desired.Bucket, bucket), 1)
+		}
+		desired.Bucket = bucket
+	}
+	if desired.Bucket == "" {
+		return cli.Exit("配置文件中未指定bucket, 请使用--bucket指定存储桶", 1)
+	}
+
+	client := NewClient()
+	current, err := exportBucketConfig(client, desired.Bucket)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	// 未指定acl时保持不变
+	if desired.ACL == "" {
+		desired.ACL = current.ACL
+	}
+	// 未指定objectLock时保持不变, 以免误删对象锁定配置
+	if desired.ObjectLock == nil {
+		desired.ObjectLock = current.ObjectLock
+	}
+
+	var changed []configSection
+	for _, section := range configSections {
+		from, to := &bucketConfig{}, &bucketConfig{}
+		section.pick(current, from)
+		section.pick(desired, to)
+		before, err := marshalBucketConfig(from)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		after, err := marshalBucketConfig(to)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		if bytes.Equal(before, after) {
+			continue
+		}
+		changed = append(changed, section)
+		fmt.Printf("~ %s\n", section.name)
+		for _, line := range diffLines(splitLines(before), splitLines(after)) {
+			fmt.Println(line)
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Println("配置一致, 无需变更")
+		return nil
+	}
+	if plan {
+		fmt.Printf("共 %d 项变更\n", len(changed))
+		return nil
+	}
+	for _, section := range changed {
+		if err := section.apply(client, desired.Bucket, desired); err != nil {
+			return cli.Exit(fmt.Sprintf("应用%s失败: %v", section.name, err), 1)
+		}
+		fmt.Println("已应用", section.name)
+	}
+	return nil
+}
+
+func loadBucketConfig(file string) (*bucketConfig, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	conf := &bucketConfig{}
+	if err = toml.Unmarshal(data, conf); err != nil {
+		return nil, err
+	}
+	if conf.Policy != "" {
+		if conf.Policy, err = normalizePolicy(conf.Policy); err != nil {
+			return nil, fmt.Errorf("policy格式错误: %v", err)
+		}
+	}
+	return conf, nil
+}
+
+func marshalBucketConfig(conf *bucketConfig) ([]byte, error) {
+	var buf bytes.Buffer
+	err := toml.NewEncoder(&buf).Order(toml.OrderPreserve).Encode(conf)
+	return buf.Bytes(), err
+}
+
+// normalizePolicy 格式化策略JSON, 使内容相同的策略文本一致
+func normalizePolicy(text string) (string, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	return string(data), err
+}
+
+// isNotConfigured 存储桶未设置该项配置时返回404, 存储桶不存在除外
+func isNotConfigured(err error) bool {
+	e, ok := err.(oossdk.ServiceError)
+	return ok && e.StatusCode == http.StatusNotFound && e.Code != "NoSuchBucket"
+}
+
+// exportBucketConfig 读取存储桶的当前配置
+func exportBucketConfig(client *oossdk.Client, bucket string) (*bucketConfig, error) {
+	conf := &bucketConfig{Bucket: bucket}
+
+	acl, err := client.GetBucketACL(bucket)
+	if err != nil {
+		return nil, err
+	}
+	conf.ACL = string(bucketACL(acl))
+
+	policy, err := client.GetBucketPolicy(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return nil, err
+	}
+	if err == nil && strings.TrimSpace(policy) != "" {
+		if conf.Policy, err = normalizePolicy(policy); err != nil {
+			return nil, err
+		}
+	}
+
+	logging, err := client.GetBucketLogging(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return nil, err
+	}
+	if logging.LoggingEnabled.TargetBucket != "" {
+		conf.Logging = &loggingConfig{
+			TargetBucket: logging.LoggingEnabled.TargetBucket,
+			TargetPrefix: logging.LoggingEnabled.TargetPrefix,
+		}
+	}
+
+	website, err := client.GetBucketWebsite(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return nil, err
+	}
+	conf.Website = newWebsiteConfig(website)
+
+	lock, err := client.GetBucketObjectLock(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return nil, err
+	}
+	if lock.ObjectLockEnabled != "" {
+		conf.ObjectLock = &objectLockConfig{
+			ObjectLockEnabled: lock.ObjectLockEnabled,
+			Mode:              lock.DefaultRetention.Mode,
+			Days:              lock.DefaultRetention.Days,
+			Years:             lock.DefaultRetention.Years,
+		}
+	}
+
+	lifecycle, err := client.GetBucketLifecycle(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return nil, err
+	}
+	for _, rule := range lifecycle.Rules {
+		conf.Lifecycle = append(conf.Lifecycle, newLifecycleRuleConfig(rule))
+	}
+
+	cors, err := client.GetBucketCors(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return nil, err
+	}
+	for _, rule := range cors {
+		conf.CORS = append(conf.CORS, corsRuleConfig{
+			AllowedOrigins: rule.AllowedOrigin,
+			AllowedMethods: rule.AllowedMethod,
+			AllowedHeaders: rule.AllowedHeader,
+			ExposeHeaders:  rule.ExposeHeader,
+			MaxAgeSeconds:  rule.MaxAgeSeconds,
+		})
+	}
+	return conf, nil
+}
+
+func newWebsiteConfig(website oossdk.GetBucketWebsiteResult) *websiteConfig {
+	conf := &websiteConfig{}
+	if website.IndexDocument != nil {
+		conf.IndexDocument = website.IndexDocument.Suffix
+	}
+	if website.ErrorDocument != nil {
+		conf.ErrorDocument = website.ErrorDocument.Key
+	}
+	if website.WebsiteAllRequestTo != nil {
+		conf.RedirectAllRequestsTo = &redirectConfig{
+			HostName: website.WebsiteAllRequestTo.HostName,
+			Protocol: website.WebsiteAllRequestTo.Protocol,
+		}
+	}
+	if website.RoutingRules != nil {
+		for _, rule := range *website.RoutingRules {
+			var r routingRuleConfig
+			if rule.Condition != nil {
+				r.KeyPrefixEquals = rule.Condition.KeyPrefixEquals
+				r.HttpErrorCodeReturnedEquals = rule.Condition.HttpErrorCodeReturnedEquals
+			}
+			if rule.Redirect != nil {
+				r.HostName = rule.Redirect.HostName
+				r.Protocol = rule.Redirect.Protocol
+				r.ReplaceKeyPrefixWith = rule.Redirect.ReplaceKeyPrefixWith
+				r.ReplaceKeyWith = rule.Redirect.ReplaceKeyWith
+			}
+			conf.RoutingRules = append(conf.RoutingRules, r)
+		}
+	}
+	if conf.IndexDocument == "" && conf.ErrorDocument == "" && conf.RedirectAllRequestsTo == nil && len(conf.RoutingRules) == 0 {
+		return nil
+	}
+	return conf
+}
+
+func (c *websiteConfig) toSDK() oossdk.WebsiteConfiguration {
+	conf := oossdk.WebsiteConfiguration{
+		IndexDocument: oossdk.IndexDocument{Suffix: c.IndexDocument},
+		ErrorDocument: oossdk.ErrorDocument{Key: c.ErrorDocument},
+	}
+	if c.RedirectAllRequestsTo != nil {
+		conf.WebsiteAllRequestTo = &oossdk.WebsiteAllRequestToXML{
+			HostName: c.RedirectAllRequestsTo.HostName,
+			Protocol: c.RedirectAllRequestsTo.Protocol,
+		}
+	}
+	for _, r := range c.RoutingRules {
+		rule := oossdk.RoutingRule{}
+		if r.KeyPrefixEquals != "" || r.HttpErrorCodeReturnedEquals != "" {
+			rule.Condition = &oossdk.Condition{
+				KeyPrefixEquals:             r.KeyPrefixEquals,
+				HttpErrorCodeReturnedEquals: r.HttpErrorCodeReturnedEquals,
+			}
+		}
+		rule.Redirect = &oossdk.Redirect{
+			HostName:             r.HostName,
+			Protocol:             r.Protocol,
+			ReplaceKeyPrefixWith: r.ReplaceKeyPrefixWith,
+			ReplaceKeyWith:       r.ReplaceKeyWith,
+		}
+		conf.RoutingRules = append(conf.RoutingRules, rule)
+	}
+	return conf
+}
+
+func (c *objectLockConfig) toSDK() oossdk.BucketObjectLock {
+	return oossdk.BucketObjectLock{
+		ObjectLockEnabled: c.ObjectLockEnabled,
+		DefaultRetention: oossdk.DefaultRetention{
+			Mode:  c.Mode,
+			Days:  c.Days,
+			Years: c.Years,
+		},
+	}
+}
+
+func newLifecycleRuleConfig(rule oossdk.LifecycleRule) lifecycleRuleConfig {
+	r := lifecycleRuleConfig{ID: rule.ID, Prefix: rule.Prefix, Status: rule.Status}
+	if rule.Expiration != nil {
+		r.ExpirationDays = rule.Expiration.Days
+		r.ExpirationDate = rule.Expiration.Date
+	}
+	if rule.Transition != nil {
+		r.TransitionDays = rule.Transition.Days
+		r.TransitionDate = rule.Transition.Date
+		r.TransitionStorageClass = rule.Transition.StorageClass
+	}
+	return r
+}
+
+func (r lifecycleRuleConfig) toSDK() oossdk.LifecycleRule {
+	rule := oossdk.LifecycleRule{ID: r.ID, Prefix: r.Prefix, Status: r.Status}
+	if r.ExpirationDays > 0 || r.ExpirationDate != "" {
+		rule.Expiration = &oossdk.LifecycleExpiration{Days: r.ExpirationDays, Date: r.ExpirationDate}
+	}
+	if r.TransitionDays > 0 || r.TransitionDate != "" || r.TransitionStorageClass != "" {
+		rule.Transition = &oossdk.LifecycleTransition{
+			Days:         r.TransitionDays,
+			Date:         r.TransitionDate,
+			StorageClass: r.TransitionStorageClass,
+		}
+	}
+	return rule
+}
+
+func (r corsRuleConfig) toSDK() oossdk.CORSRule {
+	return oossdk.CORSRule{
+		AllowedOrigin: r.AllowedOrigins,
+		AllowedMethod: r.AllowedMethods,
+		AllowedHeader: r.AllowedHeaders,
+		ExposeHeader:  r.ExposeHeaders,
+		MaxAgeSeconds: r.MaxAgeSeconds,
+	}
+}
+
+func splitLines(data []byte) []string {
+	s := strings.Trim(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines 基于最长公共子序列逐行比较, 删除的行以-开头, 新增的行以+开头
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "- "+a[i])
+			i++
+		default:
+			out = append(out, "+ "+b[j])
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+// rangePattern 合法的范围格式: 1024-2048, 1024-, -2048
+var rangePattern = regexp.MustCompile(`^(\d+-\d*|-\d+)$`)
+
+func catCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "cat",
+		Usage: "将文件内容输出到标准输出",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "key",
+				Usage:    "文件名",
+				Aliases:  []string{"k"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "range",
+				Usage: "只输出指定范围的字节, 如 0-1023, 1024-, -1024 (最后1024字节)",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			return NewOos(ctx).catFile(ctx.String("key"), ctx.String("range"))
+		},
+	}
+}
+
+// catFile 将对象内容直接写入标准输出, 不落地临时文件
+func (oos *Oos) catFile(key, byteRange string) error {
+	var options []oossdk.Option
+	if byteRange != "" {
+		if !rangePattern.MatchString(byteRange) {
+			return cli.Exit(fmt.Sprintf("范围格式错误: %s", byteRange), 1)
+		}
+		options = append(options, oossdk.NormalizedRange(byteRange))
+	}
+	body, err := oos.bucket.GetObject(key, options...)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	defer body.Close()
+	if _, err = io.Copy(os.Stdout, body); err != nil {
+		return cli.Exit(err, 1)
+	}
+	return nil
+}
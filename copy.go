@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/gosuri/uilive"
+	"github.com/urfave/cli/v2"
+)
+
+func copyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "src",
+			Usage:    "源文件名, 递归时为源前缀, 按目录处理",
+			Aliases:  []string{"s"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "dest",
+			Usage:    "目标文件名, 以/结尾时保留源文件名, 递归时为目标前缀, 按目录处理",
+			Aliases:  []string{"d"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "src-bucket",
+			Usage: "源存储桶 (默认为--bucket)",
+		},
+		&cli.StringFlag{
+			Name:  "dest-bucket",
+			Usage: "目标存储桶 (默认为--bucket)",
+		},
+		&cli.BoolFlag{
+			Name:    "recursive",
+			Usage:   "复制前缀下的所有文件",
+			Aliases: []string{"r"},
+		},
+		&cli.IntFlag{
+			Name:    "concurrent",
+			Usage:   "并发数量",
+			Value:   10,
+			Aliases: []string{"c"},
+		},
+		&cli.StringFlag{
+			Name:  "threshold",
+			Value: "5g",
+			Usage: "超过该大小的文件使用分片复制",
+		},
+		&cli.StringFlag{
+			Name:    "block",
+			Aliases: []string{"b"},
+			Value:   "100m",
+			Usage:   "分片复制的分片大小",
+		},
+		&cli.StringFlag{
+			Name:  "checkpoint-dir",
+			Usage: "分片复制的断点文件目录 (默认为系统临时目录下的ctyun-oos-upload)",
+		},
+	}
+}
+
+func cpCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "cp",
+		Usage: "在存储桶内或存储桶之间复制文件",
+		Flags: copyFlags(),
+		Action: func(ctx *cli.Context) error {
+			return NewOos(ctx).copyCmdAction(ctx, false)
+		},
+	}
+}
+
+func mvCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "mv",
+		Usage: "在存储桶内或存储桶之间移动文件",
+		Flags: copyFlags(),
+		Action: func(ctx *cli.Context) error {
+			return NewOos(ctx).copyCmdAction(ctx, true)
+		},
+	}
+}
+
+// copyTask 一个待复制的文件
+type copyTask struct {
+	srcKey  string
+	destKey string
+	size    int64
+}
+
+func (oos *Oos) copyCmdAction(ctx *cli.Context, move bool) error {
+	src, dest := oos.bucket, oos.bucket
+	var err error
+	if name := ctx.String("src-bucket"); name != "" {
+		if src, err = oos.client.Bucket(name); err != nil {
+			return cli.Exit(err, 1)
+		}
+	}
+	if name := ctx.String("dest-bucket"); name != "" {
+		if dest, err = oos.client.Bucket(name); err != nil {
+			return cli.Exit(err, 1)
+		}
+	}
+
+	srcKey, destKey := ctx.String("src"), ctx.String("dest")
+	var tasks []copyTask
+	if ctx.Bool("recursive") {
+		// 前缀按目录处理, 以免 logs 匹配到 logs-old/ 下的文件
+		srcKey, destKey = dirPrefix(srcKey), dirPrefix(destKey)
+		objects, err := listObjects(src, srcKey)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		for _, object := range objects {
+			if strings.HasSuffix(object.Key, "/") {
+				continue
+			}
+			tasks = append(tasks, copyTask{object.Key, destKey + strings.TrimPrefix(object.Key, srcKey), object.Size})
+		}
+	} else {
+		meta, err := src.HeadObject(srcKey)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		size, _ := strconv.ParseInt(meta.Get(oossdk.HTTPHeaderContentLength), 10, 64)
+		if strings.HasSuffix(destKey, "/") {
+			destKey += path.Base(srcKey)
+		}
+		tasks = append(tasks, copyTask{srcKey, destKey, size})
+	}
+
+	threshold, block, concurrent := parseSize(ctx.String("threshold")), parseSize(ctx.String("block")), ctx.Int("concurrent")
+	cpDir := ctx.String("checkpoint-dir")
+	if cpDir == "" {
+		cpDir = filepath.Join(os.TempDir(), "ctyun-oos-upload")
+	}
+	var c int32
+	var mu sync.Mutex
+	var copyFailed []string
+	w := uilive.New()
+	w.Start()
+	runConcurrent(concurrent, func(run func(func())) {
+		for _, task := range tasks {
+			task := task
+			run(func() {
+				err := oos.copyObject(src, dest, task, threshold, block, cpDir)
+				if err == nil && move {
+					err = src.DeleteObject(task.srcKey)
+				}
+				if err != nil {
+					mu.Lock()
+					copyFailed = append(copyFailed, fmt.Sprintf("%s: %v", task.srcKey, err))
+					mu.Unlock()
+					return
+				}
+				n := atomic.AddInt32(&c, 1)
+				if oos.verbose {
+					fmt.Println(task.srcKey, "->", task.destKey)
+				} else {
+					fmt.Fprintf(w, "已处理%d个文件\n", n)
+				}
+			})
+		}
+	})
+	w.Stop()
+
+	fmt.Printf("完成, 共 %d 个, 成功 %d 个", len(tasks), c)
+	if len(copyFailed) > 0 {
+		fmt.Printf(", 失败%d \n", len(copyFailed))
+		for _, v := range copyFailed {
+			fmt.Println(v)
+		}
+		return cli.Exit("", 1)
+	}
+	fmt.Println()
+	return nil
+}
+
+// copyObject 复制单个文件, 超过threshold的文件使用分片复制
+func (oos *Oos) copyObject(src, dest *oossdk.Object, task copyTask, threshold, block int64, cpDir string) error {
+	if src.BucketName == dest.BucketName && task.srcKey == task.destKey {
+		return errors.New("源文件与目标文件相同")
+	}
+	if task.size > threshold {
+		return copyMultipart(src, dest, task, block, cpDir)
+	}
+	var err error
+	switch {
+	case src.BucketName == dest.BucketName:
+		_, err = src.CopyObject(task.srcKey, task.destKey)
+	case dest.BucketName == oos.bucket.BucketName:
+		_, err = dest.CopyObjectFrom(src.BucketName, task.srcKey, task.destKey)
+	default:
+		_, err = src.CopyObjectTo(dest.BucketName, task.destKey, task.srcKey)
+	}
+	return err
+}
+
+// copyMultipart 按分片复制大文件, 断点文件保存在cpDir中, 分片数量超过上限时自动增大分片.
+// 文件之间已经并发, 单个文件的分片串行复制, 以免请求数达到concurrent的平方
+func copyMultipart(src, dest *oossdk.Object, task copyTask, block int64, cpDir string) error {
+	if task.size/block >= oossdk.MaxPartNum {
+		block = task.size/oossdk.MaxPartNum + 1
+	}
+	return dest.CopyFile(src.BucketName, task.srcKey, task.destKey, block, oossdk.Routines(1), oossdk.CheckpointDir(true, cpDir))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func corsCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "cors",
+		Usage: "检查存储桶跨域规则",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "test",
+				Usage:     "在本地模拟浏览器的预检请求, 不指定规则文件时使用存储桶当前的规则",
+				ArgsUsage: "[规则文件, .toml为存储桶配置文件, 其他按XML解析]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "origin",
+						Usage:    "请求来源, 如 https://example.com",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "method",
+						Usage:    "请求方法, 如 PUT",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:    "header",
+						Aliases: []string{"H"},
+						Usage:   "请求头, 可指定多个或以逗号分隔, 如 content-type,x-amz-meta-name",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					var rules []oossdk.CORSRule
+					var err error
+					if file := ctx.Args().First(); file != "" {
+						rules, err = readCORSRules(file)
+					} else {
+						var bucket string
+						if bucket, err = requireBucket(ctx); err != nil {
+							return err
+						}
+						rules, err = NewClient().GetBucketCors(bucket)
+						if isNotConfigured(err) {
+							err = nil
+						}
+					}
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+
+					req := oossdk.CORSRequest{Origin: ctx.String("origin"), Method: strings.ToUpper(ctx.String("method"))}
+					for _, v := range ctx.StringSlice("header") {
+						for _, h := range strings.Split(v, ",") {
+							if h = strings.TrimSpace(h); h != "" {
+								req.Headers = append(req.Headers, h)
+							}
+						}
+					}
+					return printCORSResult(oossdk.EvaluateCORS(rules, req))
+				},
+			},
+		},
+	}
+}
+
+// readCORSRules 从存储桶配置文件或跨域规则XML文件读取规则
+func readCORSRules(file string) ([]oossdk.CORSRule, error) {
+	var rules []oossdk.CORSRule
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		conf, err := loadBucketConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range conf.CORS {
+			rules = append(rules, rule.toSDK())
+		}
+		return rules, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var conf oossdk.CORSXML
+	if err = xml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("跨域规则格式错误: %v", err)
+	}
+	return conf.CORSRules, nil
+}
+
+// printCORSResult 输出预检结果, 预检失败时返回错误, 便于在脚本中判断
+func printCORSResult(result oossdk.CORSResult) error {
+	if !result.Allowed {
+		for _, reason := range result.Reasons {
+			fmt.Println(reason)
+		}
+		return cli.Exit("预检失败", 1)
+	}
+	fmt.Printf("预检通过, 匹配第 %d 条规则\n", result.Index)
+	keys := make([]string, 0, len(result.Header))
+	for k := range result.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("%s: %s\n", k, result.Header.Get(k))
+	}
+	return nil
+}
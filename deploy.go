@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	cacheControlImmutable = "public, max-age=31536000, immutable"
+	cacheControlNoCache   = "no-cache"
+)
+
+func websiteDeployCmd() *cli.Command {
+	return &cli.Command{
+		Name:      "deploy",
+		Usage:     "发布静态网站: 先上传资源文件再上传HTML, 指定--delete时删除目录中已不存在的文件",
+		ArgsUsage: "<目录>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "prefix",
+				Usage: "存储桶前缀",
+			},
+			&cli.GenericFlag{
+				Name:  "cache",
+				Value: &cacheRuleFlag{},
+				Usage: "按文件设置Cache-Control, 格式为 glob=value, 可指定多个, 按顺序匹配. " +
+					"glob不含/时匹配文件名, 否则匹配相对路径. 未匹配的HTML为no-cache, 带哈希的资源文件长期缓存",
+			},
+			&cli.StringFlag{
+				Name:  "index",
+				Usage: "设置存储桶静态网站的默认首页",
+			},
+			&cli.StringFlag{
+				Name:  "error",
+				Usage: "设置存储桶静态网站的错误页面, 为目录中的相对路径",
+			},
+			&cli.BoolFlag{
+				Name:  "delete",
+				Usage: "删除存储桶前缀下目录中已不存在的文件, 前缀按目录处理",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "未指定--prefix时允许--delete删除整个存储桶中目录已不存在的文件",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "上传所有文件, 包括内容未变化的文件, 用于更新Cache-Control",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "只输出将要执行的操作",
+			},
+			&cli.IntFlag{
+				Name:    "concurrent",
+				Usage:   "并发数量",
+				Value:   10,
+				Aliases: []string{"c"},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			dir := ctx.Args().First()
+			if dir == "" {
+				return cli.Exit("请指定目录", 1)
+			}
+			rules, err := parseCacheRules(*ctx.Generic("cache").(*cacheRuleFlag))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			oos := NewOos(ctx)
+			prefix := dirPrefix(ctx.String("prefix"))
+			if ctx.Bool("delete") {
+				if err := checkMirrorPrefix(prefix, ctx.Bool("force")); err != nil {
+					return err
+				}
+			}
+			plan, err := oos.planDeploy(filepath.Clean(dir), prefix, rules, ctx.Bool("all"), ctx.Bool("delete"))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			if ctx.Bool("dry-run") {
+				plan.print()
+				return nil
+			}
+			if err = oos.deploy(plan, ctx.Int("concurrent")); err != nil {
+				return err
+			}
+			if ctx.IsSet("index") || ctx.IsSet("error") {
+				errorDocument := ctx.String("error")
+				if errorDocument != "" {
+					errorDocument = prefix + errorDocument
+				}
+				return setWebsiteDocuments(oos.client, ctx.String("bucket"), ctx.String("index"), errorDocument)
+			}
+			return nil
+		},
+	}
+}
+
+// cacheRuleFlag 可重复指定的--cache, Cache-Control中含有逗号, 因此不能使用StringSliceFlag
+type cacheRuleFlag []string
+
+func (f *cacheRuleFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (f *cacheRuleFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+// cacheRule 匹配pattern的文件使用value作为Cache-Control
+type cacheRule struct {
+	pattern string
+	value   string
+}
+
+func parseCacheRules(values []string) ([]cacheRule, error) {
+	var rules []cacheRule
+	for _, v := range values {
+		pattern, value, ok := strings.Cut(v, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("--cache 格式错误: %s", v)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("--cache glob格式错误: %s", pattern)
+		}
+		rules = append(rules, cacheRule{pattern: pattern, value: value})
+	}
+	return rules, nil
+}
+
+// cacheControl 返回文件的Cache-Control, 自定义规则优先
+func cacheControl(rules []cacheRule, key string) string {
+	for _, rule := range rules {
+		name := key
+		if !strings.Contains(rule.pattern, "/") {
+			name = path.Base(key)
+		}
+		if ok, _ := path.Match(rule.pattern, name); ok {
+			return rule.value
+		}
+	}
+	switch {
+	case isHTML(key):
+		return cacheControlNoCache
+	case isHashedAsset(key):
+		return cacheControlImmutable
+	}
+	return ""
+}
+
+func isHTML(key string) bool {
+	ext := strings.ToLower(path.Ext(key))
+	return ext == ".html" || ext == ".htm"
+}
+
+// isHashedAsset 文件名中以.或-分隔的最后一段为至少8位且含数字的字母数字串时视为带哈希, 如 app.3f2a9c1b.js, index-B1x9aZ3q.css
+func isHashedAsset(key string) bool {
+	name := path.Base(key)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	i := strings.LastIndexAny(name, ".-")
+	if i < 0 {
+		return false
+	}
+	hash := name[i+1:]
+	if len(hash) < 8 {
+		return false
+	}
+	digit := false
+	for _, c := range hash {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		default:
+			return false
+		}
+	}
+	return digit
+}
+
+// deployFile 待上传的文件
+type deployFile struct {
+	localFile
+	objectKey    string
+	contentType  string
+	cacheControl string
+}
+
+// deployPlan 资源文件先于HTML上传, 最后删除过期文件
+type deployPlan struct {
+	assets  []deployFile
+	pages   []deployFile
+	stale   []string
+	skipped int
+}
+
+func (oos *Oos) planDeploy(dir, prefix string, rules []cacheRule, all, mirror bool) (*deployPlan, error) {
+	files, err := walkLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := listObjects(oos.bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	remote := make(map[string]oossdk.ObjectProperties, len(objects))
+	for _, obj := range objects {
+		remote[obj.Key] = obj
+	}
+
+	plan := &deployPlan{}
+	for _, f := range files {
+		key := prefix + f.key
+		if obj, ok := remote[key]; ok && !all && f.size == obj.Size {
+			same, err := sameContent(f, obj)
+			if err != nil {
+				return nil, err
+			}
+			if same {
+				plan.skipped++
+				continue
+			}
+		}
+		df := deployFile{
+			localFile:    f,
+			objectKey:    key,
+			contentType:  oossdk.TypeByExtension(f.path),
+			cacheControl: cacheControl(rules, f.key),
+		}
+		if isHTML(f.key) {
+			plan.pages = append(plan.pages, df)
+		} else {
+			plan.assets = append(plan.assets, df)
+		}
+	}
+	if mirror {
+		for key := range remote {
+			if _, ok := files[strings.TrimPrefix(key, prefix)]; !ok && !strings.HasSuffix(key, "/") {
+				plan.stale = append(plan.stale, key)
+			}
+		}
+	}
+	for _, list := range [][]deployFile{plan.assets, plan.pages} {
+		sort.Slice(list, func(i, j int) bool { return list[i].objectKey < list[j].objectKey })
+	}
+	sort.Strings(plan.stale)
+	return plan, nil
+}
+
+func (p *deployPlan) print() {
+	for _, f := range append(p.assets, p.pages...) {
+		cache := f.cacheControl
+		if cache == "" {
+			cache = "-"
+		}
+		fmt.Printf("上传 %s (%s, %s)\n", f.objectKey, f.contentType, cache)
+	}
+	for _, key := range p.stale {
+		fmt.Println("删除", key)
+	}
+	fmt.Printf("共上传 %d 个, 删除 %d 个, 跳过 %d 个未变化的文件\n", len(p.assets)+len(p.pages), len(p.stale), p.skipped)
+}
+
+// deploy 按资源文件、HTML、过期文件的顺序执行, 前一步有失败时停止, 以免HTML引用不存在的资源
+func (oos *Oos) deploy(plan *deployPlan, concurrent int) error {
+	stat := &syncStat{skipped: int32(plan.skipped)}
+	for _, files := range [][]deployFile{plan.assets, plan.pages} {
+		runConcurrent(concurrent, func(run func(func())) {
+			for _, f := range files {
+				f := f
+				run(func() {
+					options := []oossdk.Option{}
+					if f.contentType != "" {
+						options = append(options, oossdk.ContentType(f.contentType))
+					}
+					if f.cacheControl != "" {
+						options = append(options, oossdk.CacheControl(f.cacheControl))
+					}
+					if err := oos.bucket.PutObjectFromFile(f.objectKey, f.path, options...); err != nil {
+						stat.fail(f.path, err)
+						return
+					}
+					atomic.AddInt32(&stat.added, 1)
+					if oos.verbose {
+						fmt.Println("上传文件", f.objectKey)
+					}
+				})
+			}
+		})
+		if len(stat.failed) > 0 {
+			printDeployStat(stat)
+			return cli.Exit("发布失败, 未上传的HTML及过期文件保持不变", 1)
+		}
+	}
+	n, err := oos.deleteObjects(plan.stale)
+	stat.removed = int32(n)
+	if err != nil {
+		stat.fail("删除文件", err)
+	}
+	printDeployStat(stat)
+	if len(stat.failed) > 0 {
+		return cli.Exit("发布未完成", 1)
+	}
+	return nil
+}
+
+func printDeployStat(stat *syncStat) {
+	fmt.Printf("上传 %d 个, 删除 %d 个, 跳过 %d 个未变化的文件", stat.added, stat.removed, stat.skipped)
+	if len(stat.failed) > 0 {
+		fmt.Printf(", 失败 %d 个\n", len(stat.failed))
+		for _, v := range stat.failed {
+			fmt.Println(v)
+		}
+		return
+	}
+	fmt.Println()
+}
+
+// setWebsiteDocuments 设置静态网站的默认首页与错误页面, 保留其他网站配置
+func setWebsiteDocuments(client *oossdk.Client, bucket, index, errorDocument string) error {
+	website, err := client.GetBucketWebsite(bucket)
+	if err != nil && !isNotConfigured(err) {
+		return cli.Exit(err, 1)
+	}
+	config := oossdk.WebsiteConfiguration{}
+	if c := newWebsiteConfig(website); c != nil {
+		config = c.toSDK()
+	}
+	if index != "" {
+		config.IndexDocument.Suffix = index
+	}
+	if config.IndexDocument.Suffix == "" {
+		config.IndexDocument.Suffix = "index.html"
+	}
+	if errorDocument != "" {
+		config.ErrorDocument.Key = errorDocument
+	}
+	if err = client.SetBucketWebsite(bucket, config); err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Printf("已设置静态网站, 首页 %s, 错误页面 %s\n", config.IndexDocument.Suffix, config.ErrorDocument.Key)
+	return nil
+}
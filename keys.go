@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func keysCmd() *cli.Command {
+	userFlag := &cli.StringFlag{
+		Name:  "user",
+		Usage: "子用户名称, 不指定时为当前用户",
+	}
+	return &cli.Command{
+		Name:  "keys",
+		Usage: "管理访问密钥",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "ls",
+				Usage: "查看访问密钥的状态与最近使用时间, *表示当前配置使用的密钥",
+				Flags: []cli.Flag{userFlag},
+				Action: func(ctx *cli.Context) error {
+					return listKeys(NewIAMClient(), ctx.String("user"))
+				},
+			},
+			{
+				Name:  "create",
+				Usage: "创建访问密钥",
+				Flags: []cli.Flag{userFlag},
+				Action: func(ctx *cli.Context) error {
+					out, err := NewIAMClient().CreateAccessKey(ctx.String("user"))
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					key := out.CreateAccessKeyResult.AcessKey
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintf(w, "AccessKeyId\t%s\n", key.AccessKeyId)
+					fmt.Fprintf(w, "SecretAccessKey\t%s\n", key.SecretAccessKey)
+					fmt.Fprintf(w, "Status\t%s\n", key.Status)
+					w.Flush()
+					fmt.Println("SecretAccessKey只在创建时返回, 请妥善保存")
+					return nil
+				},
+			},
+			{
+				Name:      "disable",
+				Usage:     "禁用访问密钥",
+				ArgsUsage: "<AccessKeyId>",
+				Flags:     []cli.Flag{forceKeyFlag()},
+				Action: func(ctx *cli.Context) error {
+					return updateKey(ctx, false)
+				},
+			},
+			{
+				Name:      "enable",
+				Usage:     "启用访问密钥",
+				ArgsUsage: "<AccessKeyId>",
+				Action: func(ctx *cli.Context) error {
+					return updateKey(ctx, true)
+				},
+			},
+			{
+				Name:      "rm",
+				Usage:     "删除访问密钥",
+				ArgsUsage: "<AccessKeyId>",
+				Flags:     []cli.Flag{userFlag, forceKeyFlag()},
+				Action: func(ctx *cli.Context) error {
+					id, err := keyArg(ctx, true)
+					if err != nil {
+						return err
+					}
+					if _, err = NewIAMClient().DeleteAccessKey(id, ctx.String("user")); err != nil {
+						return cli.Exit(err, 1)
+					}
+					fmt.Println("已删除访问密钥", id)
+					return nil
+				},
+			},
+			keysRotateCmd(),
+			keysRetireCmd(),
+		},
+	}
+}
+
+func forceKeyFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "force",
+		Usage: "允许操作当前配置使用的密钥",
+	}
+}
+
+// keyArg 取第一个参数作为AccessKeyId, protect为true且未指定--force时不允许操作当前配置使用的密钥, 以免工具自身无法继续使用
+func keyArg(ctx *cli.Context, protect bool) (string, error) {
+	id := ctx.Args().First()
+	if id == "" {
+		return "", cli.Exit("请指定AccessKeyId", 1)
+	}
+	if protect && id == currentAccessKey() && !ctx.Bool("force") {
+		return "", cli.Exit(fmt.Sprintf("%s 为当前配置使用的密钥, 确认操作请指定--force", id), 1)
+	}
+	return id, nil
+}
+
+func currentAccessKey() string {
+	key, _ := loadConfig().Get("accessKey").(string)
+	return key
+}
+
+func updateKey(ctx *cli.Context, active bool) error {
+	id, err := keyArg(ctx, !active)
+	if err != nil {
+		return err
+	}
+	if err = NewIAMClient().UpdateAccessKey(id, active); err != nil {
+		return cli.Exit(err, 1)
+	}
+	if active {
+		fmt.Println("已启用访问密钥", id)
+	} else {
+		fmt.Println("已禁用访问密钥", id)
+	}
+	return nil
+}
+
+// accessKey 访问密钥及最近使用信息
+type accessKey struct {
+	id        string
+	userName  string
+	status    string
+	primary   bool
+	created   *time.Time
+	lastUsed  *time.Time
+	service   string
+	lastError error
+}
+
+// listAccessKeys 按Marker分页列出所有访问密钥
+func listAccessKeys(client *oossdk.Client, user string) ([]accessKey, error) {
+	var keys []accessKey
+	marker := ""
+	for {
+		out, err := client.ListAccessKey(100, marker, user)
+		if err != nil {
+			return nil, err
+		}
+		result := out.ListAccessKeysResult
+		for _, m := range result.MemberList {
+			keys = append(keys, accessKey{
+				id:       m.AccessKeyId,
+				userName: m.UserName,
+				status:   m.Status,
+				primary:  strings.EqualFold(m.IsPrimary, "true"),
+				created:  m.CreateDate,
+			})
+		}
+		if !strings.EqualFold(result.IsTruncated, "true") || result.Marker == "" {
+			break
+		}
+		marker = result.Marker
+	}
+	return keys, nil
+}
+
+func listKeys(client *oossdk.Client, user string) error {
+	keys, err := listAccessKeys(client, user)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	for i := range keys {
+		out, err := client.GetAccessKeyLastUsed(keys[i].id)
+		if err != nil {
+			keys[i].lastError = err
+			continue
+		}
+		keys[i].lastUsed = out.GetAccessKeyLastUsedResult.LastUsedDate
+		keys[i].service = out.GetAccessKeyLastUsedResult.ServiceName
+	}
+
+	current := currentAccessKey()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tAccessKeyId\tUser\tStatus\tPrimary\tCreated\tLastUsed\tService")
+	for _, key := range keys {
+		mark := ""
+		if key.id == current {
+			mark = "*"
+		}
+		lastUsed := formatKeyTime(key.lastUsed)
+		if key.lastError != nil {
+			lastUsed = "error"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\n", mark, key.id, key.userName, key.status, key.primary,
+			formatKeyTime(key.created), lastUsed, key.service)
+	}
+	w.Flush()
+	fmt.Println("共", len(keys), "个访问密钥")
+	for _, key := range keys {
+		if key.lastError != nil {
+			fmt.Printf("%s 最近使用时间查询失败: %v\n", key.id, key.lastError)
+		}
+	}
+	return nil
+}
+
+func formatKeyTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func lifecycleCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "lifecycle",
+		Usage: "检查存储桶生命周期规则",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "simulate",
+				Usage:     "按生命周期规则预览文件将在何时被删除或转为低频存储, 不指定规则文件时使用存储桶当前的规则",
+				ArgsUsage: "[规则文件, .toml为存储桶配置文件, 其他按XML解析]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "只检查该前缀下的文件",
+					},
+					&cli.StringFlag{
+						Name:  "within",
+						Usage: "只显示该时间内生效的操作, 如 30d",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "以JSON格式输出",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					oos := NewOos(ctx)
+					var rules []oossdk.LifecycleRule
+					var err error
+					if file := ctx.Args().First(); file != "" {
+						rules, err = readLifecycleRules(file)
+					} else {
+						rules, err = bucketLifecycleRules(oos.client, ctx.String("bucket"))
+					}
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					var within time.Duration
+					if s := ctx.String("within"); s != "" {
+						if within, err = parseDuration(s); err != nil {
+							return cli.Exit(err, 1)
+						}
+					}
+
+					objects, err := listObjects(oos.bucket, ctx.String("prefix"))
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					events, err := oossdk.SimulateLifecycle(rules, objects)
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					if within > 0 {
+						deadline := time.Now().Add(within)
+						n := 0
+						for _, e := range events {
+							if e.Date.Before(deadline) {
+								events[n] = e
+								n++
+							}
+						}
+						events = events[:n]
+					}
+					if ctx.Bool("json") {
+						enc := json.NewEncoder(os.Stdout)
+						enc.SetIndent("", "  ")
+						return enc.Encode(events)
+					}
+					printLifecycleEvents(events, len(objects))
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// readLifecycleRules 从存储桶配置文件或生命周期XML文件读取规则
+func readLifecycleRules(file string) ([]oossdk.LifecycleRule, error) {
+	var rules []oossdk.LifecycleRule
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		conf, err := loadBucketConfig(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range conf.Lifecycle {
+			rules = append(rules, rule.toSDK())
+		}
+		return rules, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var conf oossdk.LifecycleConfiguration
+	if err = xml.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("生命周期规则格式错误: %v", err)
+	}
+	return conf.Rules, nil
+}
+
+func bucketLifecycleRules(client *oossdk.Client, bucket string) ([]oossdk.LifecycleRule, error) {
+	lifecycle, err := client.GetBucketLifecycle(bucket)
+	if isNotConfigured(err) {
+		return nil, fmt.Errorf("存储桶 %s 未设置生命周期规则", bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lifecycle.Rules, nil
+}
+
+// printLifecycleEvents 逐条输出操作, 并按规则汇总文件数与大小
+func printLifecycleEvents(events []oossdk.LifecycleEvent, total int) {
+	now := time.Now()
+	// 同一文件可能先转为低频存储再被删除, 大小按操作分别统计
+	type summary struct {
+		expire, transition         int
+		expireSize, transitionSize int64
+	}
+	var ids []string
+	summaries := map[string]*summary{}
+	due := 0
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Date\tAction\tStorageClass\tRule\tSize\tKey")
+	for _, e := range events {
+		id := e.RuleID
+		if id == "" {
+			id = "-"
+		}
+		s, ok := summaries[id]
+		if !ok {
+			s = &summary{}
+			summaries[id] = s
+			ids = append(ids, id)
+		}
+		if e.Action == oossdk.LifecycleActionExpire {
+			s.expire++
+			s.expireSize += e.Size
+		} else {
+			s.transition++
+			s.transitionSize += e.Size
+		}
+		if e.Date.Before(now) {
+			due++
+		}
+		storageClass := e.StorageClass
+		if storageClass == "" {
+			storageClass = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Date.Format("2006-01-02"), e.Action, storageClass, id,
+			humanFileSize(float64(e.Size)), e.Key)
+	}
+	w.Flush()
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Rule\tExpire\tExpireSize\tTransition\tTransitionSize")
+	for _, id := range ids {
+		s := summaries[id]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n", id, s.expire, humanFileSize(float64(s.expireSize)),
+			s.transition, humanFileSize(float64(s.transitionSize)))
+	}
+	w.Flush()
+	fmt.Printf("共检查 %d 个文件, %d 项操作\n", total, len(events))
+	if due > 0 {
+		fmt.Printf("其中 %d 项操作的生效日期已过, 将在下次执行生命周期规则时处理\n", due)
+	}
+}
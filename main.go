@@ -13,6 +13,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	oossdk "ctyun-oos-upload/oos"
 
@@ -25,16 +26,18 @@ var (
 	errFileNotExists = errors.New("文件不存在")
 )
 
+// deleteBatchSize 批量删除时每次请求的文件数量
+const deleteBatchSize = 1000
+
 func main() {
 	app := &cli.App{
 		UseShortOptionHandling: true,
 		Usage:                  "天翼云OOS文件上传工具",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "bucket",
-				Usage:    "存储桶(必传)",
-				Aliases:  []string{"b"},
-				Required: true,
+				Name:    "bucket",
+				Usage:   "存储桶(文件操作必传)",
+				Aliases: []string{"b"},
 			},
 			&cli.BoolFlag{
 				Name:    "verbose",
@@ -47,6 +50,20 @@ func main() {
 			deleteCmd(),
 			listCmd(),
 			downloadCmd(),
+			syncCmd(),
+			cpCmd(),
+			mvCmd(),
+			catCmd(),
+			statCmd(),
+			presignCmd(),
+			bucketCmd(),
+			policyCmd(),
+			lifecycleCmd(),
+			corsCmd(),
+			websiteCmd(),
+			releaseCmd(),
+			keysCmd(),
+			multipartCmd(),
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
@@ -61,7 +78,7 @@ func uploadCmd() *cli.Command {
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "file",
-				Usage:   "指定文件上传",
+				Usage:   "指定文件上传, 为 - 时从标准输入读取 (需指定--key)",
 				Aliases: []string{"f"},
 			},
 			&cli.StringFlag{
@@ -78,9 +95,9 @@ func uploadCmd() *cli.Command {
 				Name:  "prefix",
 				Usage: "上传后文件前缀",
 			},
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:  "skip",
-				Usage: "忽略指定前缀的本地文件",
+				Usage: "忽略指定前缀的本地文件, 可指定多个",
 			},
 			&cli.IntFlag{
 				Name:    "concurrent",
@@ -104,17 +121,48 @@ func uploadCmd() *cli.Command {
 				Usage:   "上传后文件名",
 				Aliases: []string{"k"},
 			},
+			&cli.BoolFlag{
+				Name:  "delete",
+				Usage: "上传目录时删除存储桶中本地已不存在的文件, 此时前缀按目录处理",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "未指定--prefix时允许--delete删除整个存储桶中本地已不存在的文件",
+			},
+			&cli.StringFlag{
+				Name:  "resume-upload-id",
+				Usage: "断点续传时继续该UploadId的分片上传, 按服务端已上传的分片重建断点, 只上传缺失或内容不一致的分片, 可用于在其他机器上继续上传",
+			},
+			&cli.StringFlag{
+				Name: "fingerprint",
+				Usage: "断点续传判断本地文件是否变化的方式: none 只比较大小与修改时间, md5 计算整个文件, sampled 计算头部、中间与尾部, " +
+					"chunks 计算每个分片并在续传时全部校验, resumed-chunks 只校验已上传的分片并重传变化的分片",
+				Value: string(oossdk.FingerprintSampled),
+			},
 		},
 		Action: func(ctx *cli.Context) error {
 			oos := NewOos(ctx)
-			if ctx.String("file") != "" {
+			if ctx.IsSet("resume-upload-id") && (!ctx.Bool("multipart") || ctx.String("file") == "" || ctx.String("file") == "-") {
+				return cli.Exit("--resume-upload-id 需与 -m 及 --file 一起使用", 1)
+			}
+			if ctx.String("file") == "-" {
+				return oos.uploadStream(ctx.String("key"), ctx.String("prefix"), parseSize(ctx.String("block")))
+			} else if ctx.String("file") != "" {
 				if ctx.Bool("multipart") {
-					oos.uploadMultipart(ctx.String("file"), ctx.String("key"), ctx.String("prefix"), parseSize(ctx.String("block")), ctx.Int("concurrent"))
+					return oos.uploadMultipart(ctx.String("file"), ctx.String("key"), ctx.String("prefix"), parseSize(ctx.String("block")), ctx.Int("concurrent"),
+						ctx.String("resume-upload-id"), oossdk.FingerprintMode(ctx.String("fingerprint")))
 				} else {
 					oos.uploadFile(ctx.String("file"), ctx.String("key"), ctx.String("prefix"))
 				}
 			} else if ctx.String("dir") != "" {
-				oos.uploadDir(ctx.String("dir"), ctx.StringSlice("skip"), ctx.Int("concurrent"), ctx.Bool("upload"))
+				prefix := ctx.String("prefix")
+				if ctx.Bool("delete") {
+					prefix = dirPrefix(prefix)
+					if err := checkMirrorPrefix(prefix, ctx.Bool("force")); err != nil {
+						return err
+					}
+				}
+				oos.uploadDir(ctx.String("dir"), prefix, ctx.StringSlice("skip"), ctx.Int("concurrent"), ctx.Bool("upload"), ctx.Bool("delete"))
 			}
 			return nil
 		},
@@ -180,15 +228,23 @@ func downloadCmd() *cli.Command {
 		Usage: "下载文件",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "file",
-				Usage:    "下载文件名",
-				Aliases:  []string{"f"},
-				Required: true,
+				Name:    "file",
+				Usage:   "下载文件名",
+				Aliases: []string{"f"},
+			},
+			&cli.StringFlag{
+				Name:  "prefix",
+				Usage: "下载指定前缀下的所有文件",
 			},
 			&cli.StringFlag{
 				Name:    "output",
 				Aliases: []string{"o"},
-				Usage:   "输出文件名",
+				Usage:   "输出文件名, 按前缀下载时为输出目录",
+			},
+			&cli.StringFlag{
+				Name:  "threshold",
+				Value: "100m",
+				Usage: "按前缀下载时超过该大小的文件使用分片断点下载",
 			},
 			&cli.StringFlag{
 				Name:    "block",
@@ -210,6 +266,12 @@ func downloadCmd() *cli.Command {
 		},
 		Action: func(ctx *cli.Context) error {
 			oos := NewOos(ctx)
+			if ctx.String("prefix") != "" {
+				return oos.downloadDir(ctx.String("prefix"), ctx.String("output"), parseSize(ctx.String("block")), parseSize(ctx.String("threshold")), ctx.Int("concurrent"))
+			}
+			if ctx.String("file") == "" {
+				return cli.Exit("--file 或 --prefix 必传", 1)
+			}
 			if ctx.Bool("multipart") {
 				return oos.downloadMultipart(ctx.String("file"), ctx.String("output"), parseSize(ctx.String("block")), ctx.Int("concurrent"))
 			} else {
@@ -226,6 +288,9 @@ type Oos struct {
 }
 
 func NewOos(ctx *cli.Context) *Oos {
+	if ctx.String("bucket") == "" {
+		HandleError(errors.New("--bucket 必传"))
+	}
 	client := NewClient()
 	bucket, err := client.Bucket(ctx.String("bucket"))
 	if err != nil {
@@ -253,24 +318,41 @@ func (oos *Oos) uploadFile(filePath, key, prefix string) {
 	}
 }
 
-func (oos *Oos) uploadDir(dir string, skip []string, concurrent int, upload bool) {
+func (oos *Oos) uploadDir(dir, prefix string, skip []string, concurrent int, upload, mirror bool) {
 	dir = filepath.Clean(dir)
 	_, err := os.Stat(dir)
 	if os.IsNotExist(err) {
 		fmt.Println(dir, "目录不存在")
 		os.Exit(1)
 	}
+	// 镜像模式下先列出远端文件, 用于区分新增与更新以及找出需要删除的文件
+	var remote map[string]bool
+	if mirror {
+		objects, err := listObjects(oos.bucket, prefix)
+		if err != nil {
+			HandleError(err)
+		}
+		remote = make(map[string]bool, len(objects))
+		for _, object := range objects {
+			remote[object.Key] = true
+		}
+	}
+	local := map[string]bool{}
 	wg := sync.WaitGroup{}
-	var c, total int32 = 0, 0
+	var c, total, updated int32 = 0, 0, 0
 	ch := make(chan struct{}, concurrent)
 	defer close(ch)
 	w := uilive.New()
 	w.Start()
 	defer w.Stop()
+	var mu sync.Mutex
 	var uploadFailed []string
 
-	err = filepath.WalkDir(dir, func(fpath string, d fs.DirEntry, err error) error {
-		if d.IsDir() || err != nil {
+	walkErr := filepath.WalkDir(dir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
 			return nil
 		}
 		total++
@@ -278,14 +360,19 @@ func (oos *Oos) uploadDir(dir string, skip []string, concurrent int, upload bool
 		if strings.HasPrefix(fpath, dir) {
 			objectKey = fpath[len(dir)+1:]
 		}
+		// 被忽略的本地文件也计入本地列表, 镜像模式不会删除其远端文件
+		local[prefix+filepath.ToSlash(objectKey)] = true
 		if len(skip) > 0 {
 			for _, v := range skip {
-				if ok := strings.HasPrefix(objectKey, v); ok && oos.verbose {
-					fmt.Println("忽略", objectKey)
+				if strings.HasPrefix(objectKey, v) {
+					if oos.verbose {
+						fmt.Println("忽略", objectKey)
+					}
 					return nil
 				}
 			}
 		}
+		objectKey = prefix + filepath.ToSlash(objectKey)
 		if upload {
 			ch <- struct{}{}
 			wg.Add(1)
@@ -293,6 +380,9 @@ func (oos *Oos) uploadDir(dir string, skip []string, concurrent int, upload bool
 				e := oos.bucket.PutObjectFromFile(objKey, p)
 				if e == nil {
 					atomic.AddInt32(&c, 1)
+					if remote[objKey] {
+						atomic.AddInt32(&updated, 1)
+					}
 					if oos.verbose {
 						fmt.Println("上传文件", objectKey)
 					} else {
@@ -314,7 +404,9 @@ func (oos *Oos) uploadDir(dir string, skip []string, concurrent int, upload bool
 						}
 					}
 					if e != nil {
+						mu.Lock()
 						uploadFailed = append(uploadFailed, p)
+						mu.Unlock()
 					}
 				}
 				<-ch
@@ -323,14 +415,39 @@ func (oos *Oos) uploadDir(dir string, skip []string, concurrent int, upload bool
 		} else {
 			fmt.Println(fpath)
 		}
-		return err
+		return nil
 	})
-	if err != nil {
-		fmt.Println(err)
+	if walkErr != nil {
+		fmt.Println(walkErr)
 	}
 	wg.Wait()
+
+	// 删除本地已不存在的文件, 遍历目录或上传失败时不删除以免误删
+	var stale []string
+	for key := range remote {
+		if !local[key] && !strings.HasSuffix(key, "/") {
+			stale = append(stale, key)
+		}
+	}
+	var removed int
+	if mirror && walkErr != nil {
+		fmt.Println("遍历目录失败, 未删除存储桶中的文件")
+	} else if mirror && !upload {
+		for _, key := range stale {
+			fmt.Println("删除", key)
+		}
+	} else if mirror && len(uploadFailed) == 0 {
+		removed, err = oos.deleteObjects(stale)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+
 	if upload {
 		fmt.Printf("上传完成, 共 %d 个, 成功上传 %d 个", total, c)
+		if mirror {
+			fmt.Printf(", 新增 %d 个, 更新 %d 个, 删除 %d 个", c-updated, updated, removed)
+		}
 		if len(uploadFailed) > 0 {
 			fmt.Printf(", 失败%d \n", len(uploadFailed))
 			for _, v := range uploadFailed {
@@ -340,7 +457,8 @@ func (oos *Oos) uploadDir(dir string, skip []string, concurrent int, upload bool
 	}
 }
 
-func (oos *Oos) uploadMultipart(file, key, prefix string, block int64, concurrent int) error {
+// uploadMultipart 断点续传, uploadID不为空时继续该分片上传, 只在第一次尝试时按服务端分片重建断点, 重试时使用本地断点
+func (oos *Oos) uploadMultipart(file, key, prefix string, block int64, concurrent int, uploadID string, fingerprint oossdk.FingerprintMode) error {
 	fi, err := os.Stat(file)
 	if os.IsNotExist(err) {
 		return cli.Exit(errFileNotExists, 1)
@@ -357,7 +475,12 @@ func (oos *Oos) uploadMultipart(file, key, prefix string, block int64, concurren
 			name: "上传",
 			w:    uilive.New(),
 		}
-		err = oos.bucket.UploadFileWithCp(prefix+key, file, block, oossdk.Routines(concurrent), oossdk.Progress(listener), oossdk.Checkpoint(true, ".ucp"))
+		options := []oossdk.Option{oossdk.Routines(concurrent), oossdk.Progress(listener), oossdk.Checkpoint(true, ".ucp"), oossdk.Fingerprint(fingerprint)}
+		if uploadID != "" {
+			options = append(options, oossdk.ResumeUploadID(uploadID))
+			uploadID = ""
+		}
+		err = oos.bucket.UploadFileWithCp(key, file, block, options...)
 		if err != nil {
 			if listener.Start {
 				fmt.Printf("%v, 重试%d..\n", err, i)
@@ -374,6 +497,25 @@ func (oos *Oos) uploadMultipart(file, key, prefix string, block int64, concurren
 	return nil
 }
 
+// uploadStream 从标准输入读取数据, 按分片逐个上传, 适用于长度未知的管道输入
+func (oos *Oos) uploadStream(key, prefix string, block int64) error {
+	if key == "" {
+		return cli.Exit("从标准输入上传时--key必传", 1)
+	}
+	var listener = &ProgressListener{
+		name: "上传",
+		w:    uilive.New(),
+	}
+	err := oos.bucket.UploadStream(prefix+key, os.Stdin, block, oossdk.Progress(listener))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if oos.verbose {
+		fmt.Println(prefix + key)
+	}
+	return nil
+}
+
 func (oos *Oos) deleteFile(file string) error {
 	ok, err := oos.bucket.IsObjectExist(file)
 	if err != nil {
@@ -443,6 +585,52 @@ func (oos *Oos) listFile(prefix string) error {
 	return nil
 }
 
+// deleteObjects 分批删除文件, 返回删除数量
+func (oos *Oos) deleteObjects(keys []string) (int, error) {
+	var c int
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > deleteBatchSize {
+			n = deleteBatchSize
+		}
+		_, err := oos.bucket.DeleteObjects(keys[:n])
+		if err != nil {
+			return c, err
+		}
+		if oos.verbose {
+			for _, key := range keys[:n] {
+				fmt.Println("删除文件", key)
+			}
+		}
+		c += n
+		keys = keys[n:]
+	}
+	return c, nil
+}
+
+// listObjects 分页列出存储桶中前缀下的所有文件
+func listObjects(bucket *oossdk.Object, prefix string) ([]oossdk.ObjectProperties, error) {
+	pre := oossdk.Prefix(prefix)
+	marker := oossdk.Marker("")
+	var objects []oossdk.ObjectProperties
+	for {
+		lor, err := bucket.ListObjects(oossdk.MaxKeys(1000), marker, pre)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, lor.Objects...)
+		if !lor.IsTruncated {
+			break
+		}
+		next := lor.NextMarker
+		if next == "" && len(lor.Objects) > 0 {
+			next = lor.Objects[len(lor.Objects)-1].Key
+		}
+		marker = oossdk.Marker(next)
+	}
+	return objects, nil
+}
+
 func (oos *Oos) download(file, output string) error {
 	ok, err := oos.bucket.IsObjectExist(file)
 	if err != nil {
@@ -495,6 +683,76 @@ func (oos *Oos) downloadMultipart(file, output string, block int64, concurrent i
 	return nil
 }
 
+// downloadDir 下载前缀下的所有文件并在本地重建目录结构, 本地已存在且大小一致的文件跳过
+func (oos *Oos) downloadDir(prefix, output string, block, threshold int64, concurrent int) error {
+	if output == "" {
+		output = "."
+	}
+	objects, err := listObjects(oos.bucket, prefix)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	var c, skipped int32
+	var mu sync.Mutex
+	var downloadFailed []string
+	w := uilive.New()
+	w.Start()
+	runConcurrent(concurrent, func(run func(func())) {
+		for _, object := range objects {
+			object := object
+			rel := strings.TrimPrefix(object.Key, prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				continue
+			}
+			file, err := localPath(output, rel)
+			if err != nil {
+				mu.Lock()
+				downloadFailed = append(downloadFailed, fmt.Sprintf("%s: %v", object.Key, err))
+				mu.Unlock()
+				continue
+			}
+			if fi, err := os.Stat(file); err == nil && fi.Size() == object.Size {
+				atomic.AddInt32(&skipped, 1)
+				continue
+			}
+			run(func() {
+				err := os.MkdirAll(filepath.Dir(file), 0755)
+				if err == nil {
+					// 文件之间已经并发, 单个文件的分片串行下载, 以免连接数达到concurrent的平方
+					if object.Size > threshold {
+						err = oos.bucket.DownloadFileWithCp(object.Key, file, block, oossdk.Routines(1), oossdk.Checkpoint(true, file+".dcp"))
+					} else {
+						err = oos.bucket.GetObjectToFile(object.Key, file)
+					}
+				}
+				if err != nil {
+					mu.Lock()
+					downloadFailed = append(downloadFailed, fmt.Sprintf("%s: %v", object.Key, err))
+					mu.Unlock()
+					return
+				}
+				n := atomic.AddInt32(&c, 1)
+				if oos.verbose {
+					fmt.Println("下载文件", object.Key)
+				} else {
+					fmt.Fprintf(w, "已下载%d个文件\n", n)
+				}
+			})
+		}
+	})
+	w.Stop()
+	fmt.Printf("下载完成, 成功下载 %d 个, 跳过 %d 个", c, skipped)
+	if len(downloadFailed) > 0 {
+		fmt.Printf(", 失败%d \n", len(downloadFailed))
+		for _, v := range downloadFailed {
+			fmt.Println(v)
+		}
+		return cli.Exit("", 1)
+	}
+	fmt.Println()
+	return nil
+}
+
 // /*************** bucket test *******************/
 // sample.CreateBucketSample()
 // sample.GetBucketLocation()
@@ -530,13 +788,90 @@ func (oos *Oos) downloadMultipart(file, output string, block int64, concurrent i
 
 // fmt.Println("All samples completed")
 
-func NewClient() *oossdk.Client {
+// configFile 用户目录下的.oos配置文件
+func configFile() string {
 	home, _ := os.UserHomeDir()
-	config, err := toml.LoadFile(home + "/.oos")
+	return filepath.Join(home, ".oos")
+}
+
+// loadConfig 读取用户目录下的.oos配置文件
+func loadConfig() *toml.Tree {
+	config, err := toml.LoadFile(configFile())
 	if err != nil {
 		HandleError(err)
 	}
-	endpoint, accessKey, secretKey := config.Get("endpoint").(string), config.Get("accessKey").(string), config.Get("secretKey").(string)
+	return config
+}
+
+// saveConfig 写入临时文件后重命名替换, 写入中断时原配置不受影响. backup为true时先将原配置文件备份为.oos.bak,
+// 返回备份文件路径, 否则不修改已有的备份. 配置文件中的注释不会保留
+func saveConfig(config *toml.Tree, backup bool) (string, error) {
+	file := configFile()
+	data, err := config.ToTomlString()
+	if err != nil {
+		return "", err
+	}
+	backupFile := ""
+	if backup {
+		backupFile = file + ".bak"
+		old, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		if err = os.WriteFile(backupFile, old, 0600); err != nil {
+			return "", err
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".oos.tmp*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0600)
+	}
+	if err != nil {
+		return "", err
+	}
+	return backupFile, os.Rename(tmp.Name(), file)
+}
+
+func NewClient() *oossdk.Client {
+	config := loadConfig()
+	return newClient(config.Get("endpoint").(string), config)
+}
+
+// NewIAMClient 访问密钥管理使用IAM接口, 地址为配置中的iamEndpoint, 未配置时由endpoint推断, 如 oos-cn.ctyunapi.cn 对应 oos-cn-iam.ctyunapi.cn
+func NewIAMClient() *oossdk.Client {
+	config := loadConfig()
+	endpoint, ok := config.Get("iamEndpoint").(string)
+	if !ok || endpoint == "" {
+		endpoint = iamEndpoint(config.Get("endpoint").(string))
+	}
+	return newClient(endpoint, config)
+}
+
+// iamEndpoint 在域名的第一段 oos-<区域> 后加上 -iam
+func iamEndpoint(endpoint string) string {
+	scheme := ""
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		scheme, endpoint = endpoint[:i+3], endpoint[i+3:]
+	}
+	labels := strings.SplitN(endpoint, ".", 2)
+	if len(labels) == 2 && strings.HasPrefix(labels[0], "oos-") && !strings.HasSuffix(labels[0], "-iam") {
+		endpoint = labels[0] + "-iam." + labels[1]
+	}
+	return scheme + endpoint
+}
+
+func newClient(endpoint string, config *toml.Tree) *oossdk.Client {
+	accessKey, secretKey := config.Get("accessKey").(string), config.Get("secretKey").(string)
 	if !strings.HasPrefix(endpoint, "http") {
 		endpoint = "http://" + endpoint
 	}
@@ -563,6 +898,11 @@ func (l *ProgressListener) ProgressChanged(event *oossdk.ProgressEvent) {
 		l.Start = true
 		fmt.Fprintf(l.w, "开始%s..\n", l.name)
 	case oossdk.TransferDataEvent:
+		// 流式上传时总大小未知, 只显示已上传的大小
+		if event.TotalBytes <= 0 {
+			fmt.Fprintf(l.w, "%s.. %s\n", l.name, humanFileSize(float64(event.ConsumedBytes)))
+			break
+		}
 		fmt.Fprintf(l.w, "%s.. %.2f%%/%s\n", l.name, float64(event.ConsumedBytes*100)/float64(event.TotalBytes), humanFileSize(float64(event.TotalBytes)))
 	case oossdk.TransferCompletedEvent:
 		fmt.Fprintf(l.w, "%s完成\n", l.name)
@@ -612,3 +952,24 @@ func parseSize(size string) int64 {
 		return int64(float64(units[part[0][3]]) * s)
 	}
 }
+
+// parseDuration 在time.ParseDuration的基础上支持以d表示天, 如 7d, 1d12h
+func parseDuration(s string) (time.Duration, error) {
+	var d time.Duration
+	rest := s
+	if i := strings.Index(rest, "d"); i > 0 {
+		days, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return 0, fmt.Errorf("时间格式错误: %s", s)
+		}
+		d, rest = time.Duration(days)*24*time.Hour, rest[i+1:]
+		if rest == "" {
+			return d, nil
+		}
+	}
+	v, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	return d + v, nil
+}
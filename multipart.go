@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func multipartCmd() *cli.Command {
+	prefixFlag := &cli.StringFlag{
+		Name:  "prefix",
+		Usage: "只处理该前缀下的分片上传",
+	}
+	olderThanFlag := &cli.StringFlag{
+		Name:  "older-than",
+		Usage: "只处理初始化时间早于该时长之前的分片上传, 如 7d, 1d12h",
+	}
+	concurrentFlag := &cli.IntFlag{
+		Name:    "concurrent",
+		Usage:   "并发数量",
+		Value:   10,
+		Aliases: []string{"c"},
+	}
+	return &cli.Command{
+		Name:  "multipart",
+		Usage: "查看与清理未完成的分片上传, 未完成的分片上传会持续占用存储空间",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "ls",
+				Usage: "列出未完成的分片上传及已上传的分片数量与大小",
+				Flags: []cli.Flag{prefixFlag, olderThanFlag, concurrentFlag},
+				Action: func(ctx *cli.Context) error {
+					oos := NewOos(ctx)
+					uploads, err := staleUploads(oos.bucket, ctx.String("prefix"), ctx.String("older-than"))
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					return printUploads(oos.bucket, uploads, ctx.Int("concurrent"))
+				},
+			},
+			{
+				Name:      "abort",
+				Usage:     "取消分片上传并删除已上传的分片, 指定文件与UploadId时只取消该上传, 否则按--older-than批量取消",
+				ArgsUsage: "[文件 UploadId]",
+				Flags: []cli.Flag{
+					prefixFlag,
+					olderThanFlag,
+					concurrentFlag,
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "只输出将要取消的分片上传",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					oos := NewOos(ctx)
+					var uploads []oossdk.UncompletedUpload
+					switch ctx.NArg() {
+					case 2:
+						uploads = append(uploads, oossdk.UncompletedUpload{Key: ctx.Args().Get(0), UploadID: ctx.Args().Get(1)})
+					case 0:
+						if !ctx.IsSet("older-than") {
+							return cli.Exit("请指定--older-than, 或指定文件与UploadId", 1)
+						}
+						var err error
+						uploads, err = staleUploads(oos.bucket, ctx.String("prefix"), ctx.String("older-than"))
+						if err != nil {
+							return cli.Exit(err, 1)
+						}
+					default:
+						return cli.Exit("请同时指定文件与UploadId", 1)
+					}
+					if ctx.Bool("dry-run") {
+						for _, u := range uploads {
+							fmt.Println("取消", u.Key, u.UploadID)
+						}
+						fmt.Printf("共 %d 个分片上传\n", len(uploads))
+						return nil
+					}
+					return oos.abortUploads(uploads, ctx.Int("concurrent"))
+				},
+			},
+		},
+	}
+}
+
+// listMultipartUploads 按KeyMarker与UploadIDMarker分页列出未完成的分片上传
+func listMultipartUploads(bucket *oossdk.Object, prefix string) ([]oossdk.UncompletedUpload, error) {
+	keyMarker := oossdk.KeyMarker("")
+	uploadIDMarker := oossdk.UploadIDMarker("")
+	var uploads []oossdk.UncompletedUpload
+	for {
+		lmur, err := bucket.ListMultipartUploads(oossdk.MaxUploads(1000), oossdk.Prefix(prefix), keyMarker, uploadIDMarker)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, lmur.Uploads...)
+		if !lmur.IsTruncated {
+			break
+		}
+		nextKey, nextUploadID := lmur.NextKeyMarker, lmur.NextUploadIDMarker
+		if nextKey == "" && len(lmur.Uploads) > 0 {
+			last := lmur.Uploads[len(lmur.Uploads)-1]
+			nextKey, nextUploadID = last.Key, last.UploadID
+		}
+		keyMarker, uploadIDMarker = oossdk.KeyMarker(nextKey), oossdk.UploadIDMarker(nextUploadID)
+	}
+	return uploads, nil
+}
+
+// staleUploads 列出初始化时间早于olderThan之前的分片上传, olderThan为空时返回全部
+func staleUploads(bucket *oossdk.Object, prefix, olderThan string) ([]oossdk.UncompletedUpload, error) {
+	var cutoff time.Time
+	if olderThan != "" {
+		d, err := parseDuration(olderThan)
+		if err != nil {
+			return nil, err
+		}
+		cutoff = time.Now().Add(-d)
+	}
+	uploads, err := listMultipartUploads(bucket, prefix)
+	if err != nil || cutoff.IsZero() {
+		return uploads, err
+	}
+	stale := uploads[:0]
+	for _, u := range uploads {
+		if u.Initiated.Before(cutoff) {
+			stale = append(stale, u)
+		}
+	}
+	return stale, nil
+}
+
+// listUploadedParts 按PartNumberMarker分页列出已上传的分片
+func listUploadedParts(bucket *oossdk.Object, upload oossdk.UncompletedUpload) ([]oossdk.UploadedPart, error) {
+	imur := oossdk.InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: upload.Key, UploadID: upload.UploadID}
+	marker := 0
+	var parts []oossdk.UploadedPart
+	for {
+		lupr, err := bucket.ListUploadedParts(imur, oossdk.MaxParts(1000), oossdk.PartNumberMarker(marker))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, lupr.UploadedParts...)
+		if !lupr.IsTruncated || len(lupr.UploadedParts) == 0 {
+			break
+		}
+		marker = lupr.UploadedParts[len(lupr.UploadedParts)-1].PartNumber
+	}
+	return parts, nil
+}
+
+func printUploads(bucket *oossdk.Object, uploads []oossdk.UncompletedUpload, concurrent int) error {
+	type uploadSize struct {
+		parts int
+		size  int64
+		err   error
+	}
+	sizes := make([]uploadSize, len(uploads))
+	runConcurrent(concurrent, func(run func(func())) {
+		for i := range uploads {
+			i := i
+			run(func() {
+				parts, err := listUploadedParts(bucket, uploads[i])
+				sizes[i].parts, sizes[i].err = len(parts), err
+				for _, p := range parts {
+					sizes[i].size += int64(p.Size)
+				}
+			})
+		}
+	})
+
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Key\tUploadId\tInitiated\tParts\tSize")
+	for i, u := range uploads {
+		parts, size := "error", "error"
+		if sizes[i].err == nil {
+			parts, size = fmt.Sprint(sizes[i].parts), humanFileSize(float64(sizes[i].size))
+			total += sizes[i].size
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", u.Key, u.UploadID, u.Initiated.Local().Format("2006-01-02 15:04:05"), parts, size)
+	}
+	w.Flush()
+	fmt.Printf("共 %d 个未完成的分片上传, 已上传 %s\n", len(uploads), humanFileSize(float64(total)))
+	for i, u := range uploads {
+		if sizes[i].err != nil {
+			fmt.Printf("%s %s 查询分片失败: %v\n", u.Key, u.UploadID, sizes[i].err)
+		}
+	}
+	return nil
+}
+
+// abortUploads 批量取消分片上传, 已不存在的上传视为已取消
+func (oos *Oos) abortUploads(uploads []oossdk.UncompletedUpload, concurrent int) error {
+	var aborted int32
+	var mu sync.Mutex
+	var failed []string
+	runConcurrent(concurrent, func(run func(func())) {
+		for _, u := range uploads {
+			u := u
+			run(func() {
+				imur := oossdk.InitiateMultipartUploadResult{Bucket: oos.bucket.BucketName, Key: u.Key, UploadID: u.UploadID}
+				if err := oos.bucket.AbortMultipartUpload(imur); err != nil && !isNoSuchUpload(err) {
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%s %s: %v", u.Key, u.UploadID, err))
+					mu.Unlock()
+					return
+				}
+				atomic.AddInt32(&aborted, 1)
+				if oos.verbose {
+					fmt.Println("已取消", u.Key, u.UploadID)
+				}
+			})
+		}
+	})
+	fmt.Printf("已取消 %d 个分片上传", aborted)
+	if len(failed) > 0 {
+		fmt.Printf(", 失败 %d 个\n", len(failed))
+		for _, v := range failed {
+			fmt.Println(v)
+		}
+		return cli.Exit("取消分片上传未完成", 1)
+	}
+	fmt.Println()
+	return nil
+}
+
+func isNoSuchUpload(err error) bool {
+	e, ok := err.(oossdk.ServiceError)
+	return ok && e.Code == "NoSuchUpload"
+}
@@ -8,7 +8,6 @@ import (
 	"encoding/base64"
 	"encoding/xml"
 	"errors"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -113,7 +112,6 @@ func (client Client) CreateBucket(bucketName string, conf interface{}, options .
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(bs))
 	buffer.Write(bs)
 
 	headers[HTTPHeaderContentType] = "application/xml"
@@ -403,6 +401,37 @@ func (client Client) GetBucketPolicy(bucketName string) (string, error) {
 	return out, err
 }
 
+// SetBucketPolicyDocument validates the typed policy and sets it as the bucket's Policy.
+//
+// bucketName    the bucket name.
+// policy    the policy, its resources must belong to the bucket.
+//
+// error    it's nil if no error, otherwise it's an error object. It's a PolicyValidationError if the policy is invalid.
+func (client Client) SetBucketPolicyDocument(bucketName string, policy Policy) error {
+	if err := policy.Validate(bucketName); err != nil {
+		return err
+	}
+	text, err := policy.Marshal()
+	if err != nil {
+		return err
+	}
+	return client.SetBucketPolicy(bucketName, text)
+}
+
+// GetBucketPolicyDocument gets the bucket's Policy and parses it.
+//
+// bucketName    the bucket name.
+//
+// Policy    the parsed policy, valid when error is nil.
+// error    it's nil if no error, otherwise it's an error object.
+func (client Client) GetBucketPolicyDocument(bucketName string) (Policy, error) {
+	text, err := client.GetBucketPolicy(bucketName)
+	if err != nil {
+		return Policy{}, err
+	}
+	return ParsePolicy(text)
+}
+
 // SetBucketLogging sets the bucket logging settings.
 //
 // oos could automatically store the access log. Only the bucket owner could enable the logging.
@@ -0,0 +1,179 @@
+package oos
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrCheckpointNotFound is returned by CheckpointStore.Load when the checkpoint doesn't exist.
+var ErrCheckpointNotFound = errors.New("oos: checkpoint not found")
+
+// CheckpointStore saves the checkpoint data of UploadFileWithCp, DownloadFileWithCp and CopyFile.
+// The checkpoint name of a transfer is derived from its source and destination.
+type CheckpointStore interface {
+	// Load returns the checkpoint data, the error is ErrCheckpointNotFound if it doesn't exist.
+	Load(name string) ([]byte, error)
+
+	// Save saves the checkpoint data, the existing data is replaced.
+	Save(name string, data []byte) error
+
+	// Delete deletes the checkpoint, it's nil if the checkpoint doesn't exist.
+	Delete(name string) error
+
+	// List returns the names of the saved checkpoints.
+	List() ([]string, error)
+}
+
+// FileCheckpointStore saves the checkpoint of a single transfer to the file, the checkpoint name is ignored.
+type FileCheckpointStore string
+
+// Load reads the checkpoint file.
+func (s FileCheckpointStore) Load(name string) ([]byte, error) {
+	return readCheckpointFile(string(s))
+}
+
+// Save writes the checkpoint file.
+func (s FileCheckpointStore) Save(name string, data []byte) error {
+	return ioutil.WriteFile(string(s), data, FilePermMode)
+}
+
+// Delete removes the checkpoint file.
+func (s FileCheckpointStore) Delete(name string) error {
+	return removeCheckpointFile(string(s))
+}
+
+// List returns the name of the checkpoint file if it exists.
+func (s FileCheckpointStore) List() ([]string, error) {
+	if _, err := os.Stat(string(s)); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return []string{filepath.Base(string(s))}, nil
+}
+
+// DirCheckpointStore saves the checkpoint of every transfer to the file named by the checkpoint name in the directory.
+type DirCheckpointStore string
+
+// Load reads the checkpoint file in the directory.
+func (s DirCheckpointStore) Load(name string) ([]byte, error) {
+	return readCheckpointFile(filepath.Join(string(s), name))
+}
+
+// Save writes the checkpoint file in the directory, the directory is created if it doesn't exist.
+func (s DirCheckpointStore) Save(name string, data []byte) error {
+	if err := os.MkdirAll(string(s), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(string(s), name), data, FilePermMode)
+}
+
+// Delete removes the checkpoint file in the directory.
+func (s DirCheckpointStore) Delete(name string) error {
+	return removeCheckpointFile(filepath.Join(string(s), name))
+}
+
+// List returns the names of the checkpoint files in the directory.
+func (s DirCheckpointStore) List() ([]string, error) {
+	entries, err := os.ReadDir(string(s))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), cpFileSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// MemoryCheckpointStore keeps the checkpoints in memory, so the transfer can only be resumed in the same process.
+type MemoryCheckpointStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemoryCheckpointStore creates an empty MemoryCheckpointStore.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{data: map[string][]byte{}}
+}
+
+// Load returns a copy of the checkpoint data.
+func (s *MemoryCheckpointStore) Load(name string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[name]
+	if !ok {
+		return nil, ErrCheckpointNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Save keeps a copy of the checkpoint data.
+func (s *MemoryCheckpointStore) Save(name string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[name] = append([]byte(nil), data...)
+	return nil
+}
+
+// Delete deletes the checkpoint.
+func (s *MemoryCheckpointStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, name)
+	return nil
+}
+
+// List returns the sorted checkpoint names.
+func (s *MemoryCheckpointStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.data))
+	for name := range s.data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// getCheckpointStore gets the checkpoint store, it's nil if the checkpoint isn't configured.
+// The store set by CheckpointStorage takes precedence over the file of Checkpoint and the directory of CheckpointDir.
+func getCheckpointStore(cpConf *cpConfig) CheckpointStore {
+	switch {
+	case cpConf == nil:
+		return nil
+	case cpConf.Store != nil:
+		return cpConf.Store
+	case cpConf.FilePath != "":
+		return FileCheckpointStore(cpConf.FilePath)
+	case cpConf.DirPath != "":
+		return DirCheckpointStore(cpConf.DirPath)
+	}
+	return nil
+}
+
+func readCheckpointFile(filePath string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil, ErrCheckpointNotFound
+	}
+	return data, err
+}
+
+func removeCheckpointFile(filePath string) error {
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package oos
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointStore(t *testing.T) {
+	tests := []struct {
+		name  string
+		store func(dir string) CheckpointStore
+		names []string
+	}{
+		{"file", func(dir string) CheckpointStore { return FileCheckpointStore(filepath.Join(dir, "upload.cp")) }, []string{"upload.cp"}},
+		{"dir", func(dir string) CheckpointStore { return DirCheckpointStore(filepath.Join(dir, "cp")) }, []string{"a" + cpFileSuffix, "b" + cpFileSuffix}},
+		{"memory", func(dir string) CheckpointStore { return NewMemoryCheckpointStore() }, []string{"a" + cpFileSuffix, "b" + cpFileSuffix}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store(t.TempDir())
+			a, b := "a"+cpFileSuffix, "b"+cpFileSuffix
+
+			if _, err := store.Load(a); err != ErrCheckpointNotFound {
+				t.Errorf("Load() of a missing checkpoint = %v, want ErrCheckpointNotFound", err)
+			}
+			if names, err := store.List(); err != nil || len(names) != 0 {
+				t.Errorf("List() of an empty store = %v, %v", names, err)
+			}
+			if err := store.Delete(a); err != nil {
+				t.Errorf("Delete() of a missing checkpoint = %v", err)
+			}
+
+			for _, name := range []string{a, b} {
+				if err := store.Save(name, []byte("old "+name)); err != nil {
+					t.Fatal(err)
+				}
+				if err := store.Save(name, []byte(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := store.Load(b)
+			if err != nil || string(data) != b {
+				t.Errorf("Load() = %q, %v, want %q", data, err, b)
+			}
+			names, err := store.List()
+			if err != nil || strings.Join(names, ",") != strings.Join(tt.names, ",") {
+				t.Errorf("List() = %v, %v, want %v", names, err, tt.names)
+			}
+
+			if err = store.Delete(b); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = store.Load(b); err != ErrCheckpointNotFound {
+				t.Errorf("Load() after Delete() = %v, want ErrCheckpointNotFound", err)
+			}
+		})
+	}
+}
+
+func TestDirCheckpointStoreList(t *testing.T) {
+	dir := t.TempDir()
+	store := DirCheckpointStore(dir)
+	if err := store.Save("upload"+cpFileSuffix, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	// Only the checkpoint files are listed
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"+cpFileSuffix), 0755); err != nil {
+		t.Fatal(err)
+	}
+	names, err := store.List()
+	if err != nil || len(names) != 1 || names[0] != "upload"+cpFileSuffix {
+		t.Errorf("List() = %v, %v, want [upload%s]", names, err, cpFileSuffix)
+	}
+}
+
+func TestMemoryCheckpointStoreCopy(t *testing.T) {
+	store := NewMemoryCheckpointStore()
+	data := []byte("checkpoint")
+	if err := store.Save("a", data); err != nil {
+		t.Fatal(err)
+	}
+	data[0] = 'C'
+	loaded, _ := store.Load("a")
+	loaded[1] = 'H'
+	if again, _ := store.Load("a"); string(again) != "checkpoint" {
+		t.Errorf("Load() = %q, the saved data is changed by the caller", again)
+	}
+}
+
+func TestGetCheckpointStore(t *testing.T) {
+	memory := NewMemoryCheckpointStore()
+	tests := []struct {
+		name string
+		conf *cpConfig
+		want CheckpointStore
+	}{
+		{"not configured", nil, nil},
+		{"nothing set", &cpConfig{IsEnable: true}, nil},
+		{"file", &cpConfig{IsEnable: true, FilePath: "a.cp"}, FileCheckpointStore("a.cp")},
+		{"dir", &cpConfig{IsEnable: true, DirPath: "cp"}, DirCheckpointStore("cp")},
+		{"file before dir", &cpConfig{IsEnable: true, FilePath: "a.cp", DirPath: "cp"}, FileCheckpointStore("a.cp")},
+		{"store before file", &cpConfig{IsEnable: true, FilePath: "a.cp", DirPath: "cp", Store: memory}, memory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getCheckpointStore(tt.conf); got != tt.want {
+				t.Errorf("getCheckpointStore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadFileWithCpStore(t *testing.T) {
+	filePath, data := writeTestFile(t, 2*MinPartSize+100)
+	bucket, server := newTestBucket(t)
+	store := NewMemoryCheckpointStore()
+	cpName := getUploadCpName(filePath, "bk", "file.bin")
+
+	// The checkpoint of the previous attempt with the first part uploaded
+	cp := uploadCheckpoint{}
+	if err := initCheckpoint(&cp, "file.bin", filePath, MinPartSize, FingerprintSampled); err != nil {
+		t.Fatal(err)
+	}
+	cp.UploadID = server.initiate(map[int][]byte{1: data[:MinPartSize]})
+	cp.updatePart(UploadPart{PartNumber: 1, ETag: `"` + hexMD5(data[:MinPartSize]) + `"`})
+	if err := cp.dump(store, cpName); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bucket.UploadFileWithCp("file.bin", filePath, MinPartSize, CheckpointStorage(store)); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.count("UploadPart"); got != 2 {
+		t.Errorf("UploadPart called %d times, want 2", got)
+	}
+	if !bytes.Equal(server.objects["file.bin"], data) {
+		t.Error("object content differs from the file")
+	}
+	if names, _ := store.List(); len(names) != 0 {
+		t.Errorf("checkpoints left in the store: %v", names)
+	}
+}
@@ -659,7 +659,7 @@ func (um urlMaker) UriEncode(s string, isObject bool) string {
 		return s
 	}
 
-	t := make([]byte, len(s)+2*hexCount)
+	t := make([]byte, len(s)+2*(spaceCount+hexCount))
 	j := 0
 	for i := 0; i < len(s); i++ {
 		switch c := s[i]; {
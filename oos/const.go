@@ -60,6 +60,27 @@ const (
 	Requester PayerType = "requester"
 )
 
+// FingerprintMode the way UploadFileWithCp fingerprints the local file to tell whether it's changed since the checkpoint was saved
+type FingerprintMode string
+
+const (
+	// FingerprintNone only the file size and last modified time are compared
+	FingerprintNone FingerprintMode = "none"
+
+	// FingerprintMD5 the MD5 of the whole file
+	FingerprintMD5 FingerprintMode = "md5"
+
+	// FingerprintSampled the MD5 of the head, middle and tail blocks of the file
+	FingerprintSampled FingerprintMode = "sampled"
+
+	// FingerprintChunks the MD5 of every chunk, all chunks are rehashed when resuming
+	FingerprintChunks FingerprintMode = "chunks"
+
+	// FingerprintResumedChunks the MD5 of every uploaded chunk taken from the part ETag, only the uploaded chunks are rehashed when resuming
+	// and the changed ones are uploaded again
+	FingerprintResumedChunks FingerprintMode = "resumed-chunks"
+)
+
 // HTTPMethod HTTP request method
 type HTTPMethod string
 
@@ -106,6 +127,16 @@ const (
 	HTTPHeaderIfMatch            = "If-Match"
 	HTTPHeaderIfNoneMatch        = "If-None-Match"
 	HTTPHeaderConnection         = "Connection"
+	HTTPHeaderVary               = "Vary"
+
+	HTTPHeaderAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	HTTPHeaderAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	HTTPHeaderAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	HTTPHeaderAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	HTTPHeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	HTTPHeaderAccessControlMaxAge           = "Access-Control-Max-Age"
+	HTTPHeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
+	HTTPHeaderAccessControlRequestHeaders   = "Access-Control-Request-Headers"
 
 	HTTPHeaderoosACL                         = "x-amz-acl"
 	HTTPHeaderoosMetaPrefix                  = "x-amz-meta-"
@@ -170,6 +201,7 @@ const (
 const (
 	MaxPartSize = 5 * 1024 * 1024 * 1024 // Max part size, 5GB
 	MinPartSize = 100 * 1024             // Min part size, 100KB
+	MaxPartNum  = 10000                  // Max part count of a multipart upload
 
 	FilePermMode = os.FileMode(0664) // Default file permission
 
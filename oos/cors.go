@@ -0,0 +1,113 @@
+package oos
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSRequest describes a browser preflight (OPTIONS) request
+type CORSRequest struct {
+	Origin  string   // The Origin header
+	Method  string   // The Access-Control-Request-Method header
+	Headers []string // The Access-Control-Request-Headers header
+}
+
+// CORSResult is the result of EvaluateCORS
+type CORSResult struct {
+	Allowed bool        // Whether the preflight passes
+	Rule    *CORSRule   // The matched rule, nil if the preflight fails
+	Index   int         // The index of the matched rule, starting from 1, 0 if the preflight fails
+	Header  http.Header // The response headers of the preflight
+	Reasons []string    // Why each rule doesn't match, if the preflight fails
+}
+
+// EvaluateCORS checks whether a browser preflight request passes the bucket CORS rules locally.
+//
+// The first rule matching the origin, the method and all the request headers is used.
+// Origins and headers may contain one wildcard '*', headers are case-insensitive.
+//
+// rules    the CORS rules, such as the result of GetBucketCors.
+// req    the preflight request.
+//
+// CORSResult    the matched rule and the response headers, or the reasons if no rule matches.
+func EvaluateCORS(rules []CORSRule, req CORSRequest) CORSResult {
+	result := CORSResult{Header: http.Header{}}
+	if len(rules) == 0 {
+		result.Reasons = append(result.Reasons, "CORS is not configured")
+		return result
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if reason := matchCORSRule(rule, req); reason != "" {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("rule %d: %s", i+1, reason))
+			continue
+		}
+		result.Allowed = true
+		result.Rule = rule
+		result.Index = i + 1
+		result.Reasons = nil
+		result.Header = corsResponseHeader(rule, req)
+		return result
+	}
+	return result
+}
+
+// matchCORSRule returns why the rule doesn't match the request, or an empty string if it matches
+func matchCORSRule(rule *CORSRule, req CORSRequest) string {
+	if !matchAny(rule.AllowedOrigin, req.Origin, false) {
+		return fmt.Sprintf("origin %q is not allowed", req.Origin)
+	}
+	allowed := false
+	for _, method := range rule.AllowedMethod {
+		if method == req.Method {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Sprintf("method %q is not allowed", req.Method)
+	}
+	for _, header := range req.Headers {
+		if !matchAny(rule.AllowedHeader, strings.ToLower(header), true) {
+			return fmt.Sprintf("header %q is not allowed", header)
+		}
+	}
+	return ""
+}
+
+func corsResponseHeader(rule *CORSRule, req CORSRequest) http.Header {
+	header := http.Header{}
+	// The origin is echoed with credentials only if an explicit origin matches, not the wildcard "*"
+	explicit := false
+	for _, origin := range rule.AllowedOrigin {
+		if origin != "*" && MatchWildcard(origin, req.Origin) {
+			explicit = true
+			break
+		}
+	}
+	if explicit {
+		header.Set(HTTPHeaderAccessControlAllowOrigin, req.Origin)
+		header.Set(HTTPHeaderAccessControlAllowCredentials, "true")
+	} else {
+		header.Set(HTTPHeaderAccessControlAllowOrigin, "*")
+	}
+	header.Set(HTTPHeaderAccessControlAllowMethods, strings.Join(rule.AllowedMethod, ", "))
+	if len(req.Headers) > 0 {
+		headers := make([]string, len(req.Headers))
+		for i, h := range req.Headers {
+			headers[i] = strings.ToLower(h)
+		}
+		header.Set(HTTPHeaderAccessControlAllowHeaders, strings.Join(headers, ", "))
+	}
+	if len(rule.ExposeHeader) > 0 {
+		header.Set(HTTPHeaderAccessControlExposeHeaders, strings.Join(rule.ExposeHeader, ", "))
+	}
+	if rule.MaxAgeSeconds > 0 {
+		header.Set(HTTPHeaderAccessControlMaxAge, strconv.Itoa(rule.MaxAgeSeconds))
+	}
+	header.Set(HTTPHeaderVary, strings.Join([]string{HTTPHeaderOrigin,
+		HTTPHeaderAccessControlRequestHeaders, HTTPHeaderAccessControlRequestMethod}, ", "))
+	return header
+}
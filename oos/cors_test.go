@@ -0,0 +1,140 @@
+package oos
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEvaluateCORS(t *testing.T) {
+	rules := []CORSRule{
+		{
+			AllowedOrigin: []string{"https://www.example.com", "https://*.example.org"},
+			AllowedMethod: []string{"GET", "PUT"},
+			AllowedHeader: []string{"x-amz-*", "Content-Type"},
+			ExposeHeader:  []string{"ETag"},
+			MaxAgeSeconds: 600,
+		},
+		{
+			AllowedOrigin: []string{"*"},
+			AllowedMethod: []string{"GET", "HEAD"},
+			AllowedHeader: []string{"*"},
+		},
+	}
+	tests := []struct {
+		name    string
+		req     CORSRequest
+		index   int
+		headers string
+		reason  string
+	}{
+		{"exact origin", CORSRequest{Origin: "https://www.example.com", Method: "PUT"}, 1, "", ""},
+		{"wildcard origin", CORSRequest{Origin: "https://cdn.example.org", Method: "PUT"}, 1, "", ""},
+		{"wildcard origin needs a subdomain", CORSRequest{Origin: "https://example.org", Method: "PUT"}, 0, "", `origin "https://example.org" is not allowed`},
+		{"origin is case sensitive", CORSRequest{Origin: "https://WWW.example.com", Method: "PUT"}, 0, "", `origin "https://WWW.example.com" is not allowed`},
+		{"method is case sensitive", CORSRequest{Origin: "https://www.example.com", Method: "put"}, 0, "", `method "put" is not allowed`},
+		{"wildcard header", CORSRequest{Origin: "https://www.example.com", Method: "PUT", Headers: []string{"x-amz-meta-name"}}, 1, "x-amz-meta-name", ""},
+		{"wildcard header is case insensitive", CORSRequest{Origin: "https://www.example.com", Method: "PUT", Headers: []string{"X-Amz-Date", "content-type"}}, 1, "x-amz-date, content-type", ""},
+		{"exact header is case insensitive", CORSRequest{Origin: "https://www.example.com", Method: "PUT", Headers: []string{"CONTENT-TYPE"}}, 1, "content-type", ""},
+		{"wildcard header needs the prefix", CORSRequest{Origin: "https://www.example.com", Method: "PUT", Headers: []string{"x-oss-meta"}}, 0, "", `header "x-oss-meta" is not allowed`},
+		{"all headers must match", CORSRequest{Origin: "https://www.example.com", Method: "PUT", Headers: []string{"x-amz-date", "authorization"}}, 0, "", `header "authorization" is not allowed`},
+		{"falls back to the next rule", CORSRequest{Origin: "https://www.example.com", Method: "GET", Headers: []string{"authorization"}}, 2, "authorization", ""},
+		{"any origin", CORSRequest{Origin: "https://other.com", Method: "HEAD"}, 2, "", ""},
+		{"no rule matches", CORSRequest{Origin: "https://other.com", Method: "PUT"}, 0, "", `origin "https://other.com" is not allowed`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateCORS(rules, tt.req)
+			if result.Index != tt.index || result.Allowed != (tt.index > 0) {
+				t.Fatalf("EvaluateCORS() matched rule %d (allowed %v), want rule %d: %v", result.Index, result.Allowed, tt.index, result.Reasons)
+			}
+			if tt.index == 0 {
+				if result.Rule != nil || len(result.Reasons) != len(rules) {
+					t.Errorf("EvaluateCORS() = %+v, want a reason for each rule", result)
+				}
+				if first := result.Reasons[0]; first != "rule 1: "+tt.reason {
+					t.Errorf("reason of rule 1 = %q, want %q", first, tt.reason)
+				}
+				return
+			}
+			if result.Rule != &rules[tt.index-1] || len(result.Reasons) != 0 {
+				t.Errorf("EvaluateCORS() = %+v, want rule %d without reasons", result, tt.index)
+			}
+			if got := result.Header.Get(HTTPHeaderAccessControlAllowHeaders); got != tt.headers {
+				t.Errorf("%s = %q, want %q", HTTPHeaderAccessControlAllowHeaders, got, tt.headers)
+			}
+		})
+	}
+}
+
+func TestEvaluateCORSHeader(t *testing.T) {
+	rules := []CORSRule{
+		{
+			AllowedOrigin: []string{"https://www.example.com"},
+			AllowedMethod: []string{"GET", "PUT"},
+			ExposeHeader:  []string{"ETag", "x-amz-request-id"},
+			MaxAgeSeconds: 600,
+		},
+		{
+			AllowedOrigin: []string{"*", "https://a.example.com"},
+			AllowedMethod: []string{"GET"},
+		},
+	}
+	tests := []struct {
+		name   string
+		req    CORSRequest
+		header http.Header
+	}{
+		{
+			name: "specific origin",
+			req:  CORSRequest{Origin: "https://www.example.com", Method: "PUT"},
+			header: http.Header{
+				HTTPHeaderAccessControlAllowOrigin:      {"https://www.example.com"},
+				HTTPHeaderAccessControlAllowCredentials: {"true"},
+				HTTPHeaderAccessControlAllowMethods:     {"GET, PUT"},
+				HTTPHeaderAccessControlExposeHeaders:    {"ETag, x-amz-request-id"},
+				HTTPHeaderAccessControlMaxAge:           {"600"},
+			},
+		},
+		{
+			name: "any origin",
+			req:  CORSRequest{Origin: "https://other.com", Method: "GET"},
+			header: http.Header{
+				HTTPHeaderAccessControlAllowOrigin:  {"*"},
+				HTTPHeaderAccessControlAllowMethods: {"GET"},
+			},
+		},
+		{
+			name: "explicit origin listed with any origin",
+			req:  CORSRequest{Origin: "https://a.example.com", Method: "GET"},
+			header: http.Header{
+				HTTPHeaderAccessControlAllowOrigin:      {"https://a.example.com"},
+				HTTPHeaderAccessControlAllowCredentials: {"true"},
+				HTTPHeaderAccessControlAllowMethods:     {"GET"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := EvaluateCORS(rules, tt.req).Header
+			if header.Get(HTTPHeaderVary) == "" {
+				t.Errorf("%s is missing", HTTPHeaderVary)
+			}
+			header.Del(HTTPHeaderVary)
+			if len(header) != len(tt.header) {
+				t.Errorf("Header = %v, want %v", header, tt.header)
+			}
+			for key := range tt.header {
+				if got, want := header.Get(key), tt.header.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateCORSNotConfigured(t *testing.T) {
+	result := EvaluateCORS(nil, CORSRequest{Origin: "https://www.example.com", Method: "GET"})
+	if result.Allowed || len(result.Reasons) != 1 {
+		t.Errorf("EvaluateCORS() = %+v, want not configured", result)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -67,20 +66,19 @@ func (bucket Object) DownloadFileWithCp(objectKey, filePath string, partSize int
 
 	routines := getRoutines(options)
 
-	checkpoint := getCpConfig(options)
+	store := getCheckpointStore(getCpConfig(options))
+	if store == nil {
+		return errors.New("oos: checkpoint is not configured")
+	}
 
-	return bucket.downloadFileWithCp(objectKey, filePath, partSize, options, getDownloadCpFilePath(checkpoint, "", "", ""), routines, uRange)
+	return bucket.downloadFileWithCp(objectKey, filePath, partSize, options, store, getDownloadCpName(bucket.BucketName, objectKey, filePath), routines, uRange)
 }
 
-/* unused */
-func getDownloadCpFilePath(cpConf *cpConfig, srcBucket, srcObject, destFile string) string {
-	if cpConf.FilePath == "" && cpConf.DirPath != "" {
-		src := fmt.Sprintf("oos://%v/%v", srcBucket, srcObject)
-		absPath, _ := filepath.Abs(destFile)
-		cpFileName := getCpFileName(src, absPath)
-		cpConf.FilePath = cpConf.DirPath + string(os.PathSeparator) + cpFileName
-	}
-	return cpConf.FilePath
+// getDownloadCpName returns the checkpoint name of downloading the object to the local file
+func getDownloadCpName(srcBucket, srcObject, destFile string) string {
+	src := fmt.Sprintf("oos://%v/%v", srcBucket, srcObject)
+	absPath, _ := filepath.Abs(destFile)
+	return getCpFileName(src, absPath)
 }
 
 // getRangeConfig gets the download range from the options.
@@ -353,9 +351,9 @@ func (cp downloadCheckpoint) isValid(meta http.Header, uRange *unpackedRange) (b
 	return true, nil
 }
 
-// load checkpoint from local file
-func (cp *downloadCheckpoint) load(filePath string) error {
-	contents, err := ioutil.ReadFile(filePath)
+// load checkpoint from the checkpoint store
+func (cp *downloadCheckpoint) load(store CheckpointStore, name string) error {
+	contents, err := store.Load(name)
 	if err != nil {
 		return err
 	}
@@ -364,8 +362,8 @@ func (cp *downloadCheckpoint) load(filePath string) error {
 	return err
 }
 
-// dump funciton dumps to file
-func (cp *downloadCheckpoint) dump(filePath string) error {
+// dump funciton dumps to the checkpoint store
+func (cp *downloadCheckpoint) dump(store CheckpointStore, name string) error {
 	bcp := *cp
 
 	// Calculate MD5
@@ -385,7 +383,7 @@ func (cp *downloadCheckpoint) dump(filePath string) error {
 	}
 
 	// Dump
-	return ioutil.WriteFile(filePath, js, FilePermMode)
+	return store.Save(name, js)
 }
 
 // todoParts gets unfinished parts
@@ -436,13 +434,13 @@ func (cp *downloadCheckpoint) prepare(meta http.Header, bucket *Object, objectKe
 	return nil
 }
 
-func (cp *downloadCheckpoint) complete(cpFilePath, downFilepath string) error {
-	os.Remove(cpFilePath)
+func (cp *downloadCheckpoint) complete(store CheckpointStore, cpName, downFilepath string) error {
+	store.Delete(cpName)
 	return os.Rename(downFilepath, cp.FilePath)
 }
 
 // downloadFileWithCp downloads files with checkpoint.
-func (bucket Object) downloadFileWithCp(objectKey, filePath string, partSize int64, options []Option, cpFilePath string, routines int, uRange *unpackedRange) error {
+func (bucket Object) downloadFileWithCp(objectKey, filePath string, partSize int64, options []Option, store CheckpointStore, cpName string, routines int, uRange *unpackedRange) error {
 	tempFilePath := filePath + TempFileSuffix
 	listener := getProgressListener(options)
 
@@ -454,9 +452,9 @@ func (bucket Object) downloadFileWithCp(objectKey, filePath string, partSize int
 
 	// Load checkpoint data.
 	dcp := downloadCheckpoint{}
-	err := dcp.load(cpFilePath)
+	err := dcp.load(store, cpName)
 	if err != nil {
-		os.Remove(cpFilePath)
+		store.Delete(cpName)
 	}
 
 	// Get the object detailed meta.
@@ -471,7 +469,7 @@ func (bucket Object) downloadFileWithCp(objectKey, filePath string, partSize int
 		if err = dcp.prepare(meta, &bucket, objectKey, filePath, partSize, uRange); err != nil {
 			return err
 		}
-		os.Remove(cpFilePath)
+		store.Delete(cpName)
 	}
 
 	// Create the file if not exists. Otherwise the parts download will overwrite it.
@@ -508,7 +506,7 @@ func (bucket Object) downloadFileWithCp(objectKey, filePath string, partSize int
 		case part := <-results:
 			completed++
 			dcp.PartStat[part.Index] = true
-			dcp.dump(cpFilePath)
+			dcp.dump(store, cpName)
 			completedBytes += (part.End - part.Start + 1)
 			event = newProgressEvent(TransferDataEvent, completedBytes, dcp.ObjStat.Size)
 			publishProgress(listener, event)
@@ -527,5 +525,5 @@ func (bucket Object) downloadFileWithCp(objectKey, filePath string, partSize int
 	event = newProgressEvent(TransferCompletedEvent, completedBytes, dcp.ObjStat.Size)
 	publishProgress(listener, event)
 
-	return dcp.complete(cpFilePath, tempFilePath)
+	return dcp.complete(store, cpName, tempFilePath)
 }
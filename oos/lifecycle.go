@@ -0,0 +1,151 @@
+package oos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lifecycle actions
+const (
+	LifecycleActionExpire     = "Expire"
+	LifecycleActionTransition = "Transition"
+)
+
+// LifecycleEvent describes an action a lifecycle rule will take on an object
+type LifecycleEvent struct {
+	Key          string    // Object key
+	Size         int64     // Object size
+	LastModified time.Time // Object last modified time
+	RuleID       string    // The ID of the rule taking the action
+	Action       string    // Expire or Transition
+	StorageClass string    // The target storage class of a transition
+	Date         time.Time // The time when the action takes effect
+}
+
+// SimulateLifecycle reports the actions the lifecycle rules will take on the objects.
+//
+// Days are counted from the object's last modified time and rounded up to the next midnight UTC.
+// When several rules match an object, the earliest expiration wins, and a transition is only
+// reported if it takes effect before the expiration. Disabled rules are ignored.
+//
+// rules    the lifecycle rules, such as GetBucketLifecycleResult.Rules.
+// objects    the objects, such as ListObjectsResult.Objects.
+//
+// []LifecycleEvent    the actions sorted by date and key.
+// error    it's nil if all rules are valid, otherwise it's an error object.
+func SimulateLifecycle(rules []LifecycleRule, objects []ObjectProperties) ([]LifecycleEvent, error) {
+	for _, rule := range rules {
+		if err := checkLifecycleRule(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	var events []LifecycleEvent
+	for _, object := range objects {
+		var expire, transition *LifecycleEvent
+		for _, rule := range rules {
+			if !strings.EqualFold(rule.Status, "Enabled") || !strings.HasPrefix(object.Key, rule.Prefix) {
+				continue
+			}
+			if rule.Expiration != nil {
+				date, _ := lifecycleDate(object.LastModified, rule.Expiration.Days, rule.Expiration.Date)
+				if expire == nil || date.Before(expire.Date) {
+					expire = newLifecycleEvent(object, rule, LifecycleActionExpire, "", date)
+				}
+			}
+			if rule.Transition != nil && !isStorageClass(object.StorageClass, rule.Transition.StorageClass) {
+				date, _ := lifecycleDate(object.LastModified, rule.Transition.Days, rule.Transition.Date)
+				if transition == nil || date.Before(transition.Date) {
+					transition = newLifecycleEvent(object, rule, LifecycleActionTransition, rule.Transition.StorageClass, date)
+				}
+			}
+		}
+		if transition != nil && (expire == nil || transition.Date.Before(expire.Date)) {
+			events = append(events, *transition)
+		}
+		if expire != nil {
+			events = append(events, *expire)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Date.Equal(events[j].Date) {
+			return events[i].Date.Before(events[j].Date)
+		}
+		return events[i].Key < events[j].Key
+	})
+	return events, nil
+}
+
+func newLifecycleEvent(object ObjectProperties, rule LifecycleRule, action, storageClass string, date time.Time) *LifecycleEvent {
+	return &LifecycleEvent{
+		Key:          object.Key,
+		Size:         object.Size,
+		LastModified: object.LastModified,
+		RuleID:       rule.ID,
+		Action:       action,
+		StorageClass: storageClass,
+		Date:         date,
+	}
+}
+
+func checkLifecycleRule(rule LifecycleRule) error {
+	name := rule.ID
+	if name == "" {
+		name = fmt.Sprintf("prefix %q", rule.Prefix)
+	}
+	if rule.Expiration == nil && rule.Transition == nil {
+		return fmt.Errorf("oos: lifecycle rule %s has neither Expiration nor Transition", name)
+	}
+	if rule.Expiration != nil {
+		if _, err := lifecycleDate(time.Time{}, rule.Expiration.Days, rule.Expiration.Date); err != nil {
+			return fmt.Errorf("oos: lifecycle rule %s Expiration: %v", name, err)
+		}
+	}
+	if rule.Transition != nil {
+		if _, err := lifecycleDate(time.Time{}, rule.Transition.Days, rule.Transition.Date); err != nil {
+			return fmt.Errorf("oos: lifecycle rule %s Transition: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// lifecycleDate returns the time when the action takes effect on an object last modified at lastModified
+func lifecycleDate(lastModified time.Time, days int, date string) (time.Time, error) {
+	if (days > 0) == (date != "") {
+		return time.Time{}, fmt.Errorf("exactly one of Days and Date must be specified")
+	}
+	if days > 0 {
+		return nextMidnight(lastModified.AddDate(0, 0, days)), nil
+	}
+	for _, layout := range []string{lifecycleDateFormat, time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, date); err == nil {
+			// The rule also applies to objects created after the date
+			if lastModified.After(t) {
+				return nextMidnight(lastModified), nil
+			}
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid Date %q", date)
+}
+
+// nextMidnight rounds t up to midnight UTC
+func nextMidnight(t time.Time) time.Time {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if midnight.Before(t) {
+		midnight = midnight.AddDate(0, 0, 1)
+	}
+	return midnight
+}
+
+// isStorageClass checks if the object is stored in the storage class, an empty class means STANDARD
+func isStorageClass(class, target string) bool {
+	if class == "" {
+		class = string(StorageClassStandard)
+	}
+	return strings.EqualFold(class, target)
+}
@@ -0,0 +1,189 @@
+package oos
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestLifecycleDate(t *testing.T) {
+	tests := []struct {
+		name         string
+		lastModified string
+		days         int
+		date         string
+		want         string
+	}{
+		{"days rounded up to midnight", "2024-01-01T10:00:00Z", 1, "", "2024-01-03T00:00:00Z"},
+		{"days at midnight", "2024-01-01T00:00:00Z", 1, "", "2024-01-02T00:00:00Z"},
+		{"days one second after midnight", "2024-01-01T00:00:01Z", 1, "", "2024-01-03T00:00:00Z"},
+		{"days counted in UTC", "2024-01-01T23:30:00+08:00", 1, "", "2024-01-03T00:00:00Z"},
+		{"days across the previous UTC day", "2024-01-02T07:00:00+08:00", 1, "", "2024-01-03T00:00:00Z"},
+		{"days across leap day", "2024-02-28T12:00:00Z", 2, "", "2024-03-02T00:00:00Z"},
+		{"days across month end", "2024-01-31T12:00:00Z", 30, "", "2024-03-02T00:00:00Z"},
+		{"days across year end", "2024-12-31T18:00:00Z", 1, "", "2025-01-02T00:00:00Z"},
+		{"date before the object", "2024-01-01T10:00:00Z", 0, "2024-06-01T00:00:00.000Z", "2024-06-01T00:00:00Z"},
+		{"date in RFC3339", "2024-01-01T10:00:00Z", 0, "2024-06-01T00:00:00Z", "2024-06-01T00:00:00Z"},
+		{"date without time", "2024-01-01T10:00:00Z", 0, "2024-06-01", "2024-06-01T00:00:00Z"},
+		{"date after the object", "2024-07-01T05:00:00Z", 0, "2024-06-01", "2024-07-02T00:00:00Z"},
+		{"date equal to the object", "2024-06-01T00:00:00Z", 0, "2024-06-01", "2024-06-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lifecycleDate(mustParseTime(t, tt.lastModified), tt.days, tt.date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustParseTime(t, tt.want); !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("lifecycleDate() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestLifecycleDateInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		days int
+		date string
+	}{
+		{"neither days nor date", 0, ""},
+		{"both days and date", 1, "2024-06-01"},
+		{"negative days", -1, ""},
+		{"invalid date", 0, "2024/06/01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lifecycleDate(time.Time{}, tt.days, tt.date); err == nil {
+				t.Errorf("lifecycleDate(%d, %q) should fail", tt.days, tt.date)
+			}
+		})
+	}
+}
+
+func TestSimulateLifecycle(t *testing.T) {
+	lastModified := "2024-01-01T10:00:00Z"
+	expireDays := func(id, prefix string, days int) LifecycleRule {
+		return LifecycleRule{ID: id, Prefix: prefix, Status: "Enabled", Expiration: &LifecycleExpiration{Days: days}}
+	}
+	transitionDays := func(id, prefix string, days int) LifecycleRule {
+		return LifecycleRule{ID: id, Prefix: prefix, Status: "Enabled",
+			Transition: &LifecycleTransition{Days: days, StorageClass: string(StorageClassStandardIA)}}
+	}
+	type event struct {
+		key, rule, action, date string
+	}
+	tests := []struct {
+		name    string
+		rules   []LifecycleRule
+		objects []string
+		class   string
+		want    []event
+	}{
+		{
+			name:    "prefix",
+			rules:   []LifecycleRule{expireDays("logs", "logs/", 7)},
+			objects: []string{"logs/a.log", "logs-old/a.log", "a.log"},
+			want:    []event{{"logs/a.log", "logs", LifecycleActionExpire, "2024-01-09T00:00:00Z"}},
+		},
+		{
+			name: "disabled rule",
+			rules: []LifecycleRule{
+				{ID: "off", Prefix: "", Status: "Disabled", Expiration: &LifecycleExpiration{Days: 1}},
+			},
+			objects: []string{"a.log"},
+		},
+		{
+			name:    "status is case insensitive",
+			rules:   []LifecycleRule{{ID: "on", Status: "enabled", Expiration: &LifecycleExpiration{Days: 1}}},
+			objects: []string{"a.log"},
+			want:    []event{{"a.log", "on", LifecycleActionExpire, "2024-01-03T00:00:00Z"}},
+		},
+		{
+			name:    "earliest expiration wins",
+			rules:   []LifecycleRule{expireDays("all", "", 30), expireDays("logs", "logs/", 7)},
+			objects: []string{"logs/a.log"},
+			want:    []event{{"logs/a.log", "logs", LifecycleActionExpire, "2024-01-09T00:00:00Z"}},
+		},
+		{
+			name:    "transition before expiration",
+			rules:   []LifecycleRule{transitionDays("ia", "", 10), expireDays("expire", "", 30)},
+			objects: []string{"a.log"},
+			want: []event{
+				{"a.log", "ia", LifecycleActionTransition, "2024-01-12T00:00:00Z"},
+				{"a.log", "expire", LifecycleActionExpire, "2024-02-01T00:00:00Z"},
+			},
+		},
+		{
+			name:    "transition after expiration",
+			rules:   []LifecycleRule{transitionDays("ia", "", 30), expireDays("expire", "", 10)},
+			objects: []string{"a.log"},
+			want:    []event{{"a.log", "expire", LifecycleActionExpire, "2024-01-12T00:00:00Z"}},
+		},
+		{
+			name:    "transition on the expiration date",
+			rules:   []LifecycleRule{transitionDays("ia", "", 10), expireDays("expire", "", 10)},
+			objects: []string{"a.log"},
+			want:    []event{{"a.log", "expire", LifecycleActionExpire, "2024-01-12T00:00:00Z"}},
+		},
+		{
+			name:    "already in the target class",
+			rules:   []LifecycleRule{transitionDays("ia", "", 10)},
+			objects: []string{"a.log"},
+			class:   string(StorageClassStandardIA),
+		},
+		{
+			name:    "sorted by date and key",
+			rules:   []LifecycleRule{expireDays("all", "", 30), expireDays("logs", "logs/", 7)},
+			objects: []string{"b.log", "logs/b.log", "a.log", "logs/a.log"},
+			want: []event{
+				{"logs/a.log", "logs", LifecycleActionExpire, "2024-01-09T00:00:00Z"},
+				{"logs/b.log", "logs", LifecycleActionExpire, "2024-01-09T00:00:00Z"},
+				{"a.log", "all", LifecycleActionExpire, "2024-02-01T00:00:00Z"},
+				{"b.log", "all", LifecycleActionExpire, "2024-02-01T00:00:00Z"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objects []ObjectProperties
+			for _, key := range tt.objects {
+				objects = append(objects, ObjectProperties{Key: key, Size: 100, LastModified: mustParseTime(t, lastModified), StorageClass: tt.class})
+			}
+			events, err := SimulateLifecycle(tt.rules, objects)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("SimulateLifecycle() returned %d events, want %d: %+v", len(events), len(tt.want), events)
+			}
+			for i, e := range events {
+				want := tt.want[i]
+				if e.Key != want.key || e.RuleID != want.rule || e.Action != want.action || !e.Date.Equal(mustParseTime(t, want.date)) {
+					t.Errorf("event %d = %s %s %s %v, want %s %s %s %s", i, e.Key, e.RuleID, e.Action, e.Date, want.key, want.rule, want.action, want.date)
+				}
+				if e.Size != 100 {
+					t.Errorf("event %d size = %d, want 100", i, e.Size)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateLifecycleInvalidRule(t *testing.T) {
+	rules := []LifecycleRule{
+		{ID: "valid", Status: "Enabled", Expiration: &LifecycleExpiration{Days: 1}},
+		{ID: "empty", Status: "Enabled"},
+	}
+	if _, err := SimulateLifecycle(rules, nil); err == nil {
+		t.Error("SimulateLifecycle() should fail for a rule without actions")
+	}
+}
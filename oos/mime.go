@@ -149,6 +149,7 @@ var extToMimeType = map[string]string{
 	".dtd":     "application/xml-dtd",
 	".dv":      "video/x-dv",
 	".dxr":     "application/x-director",
+	".eot":     "application/vnd.ms-fontobject",
 	".eps":     "application/postscript",
 	".exe":     "application/octet-stream",
 	".ez":      "application/andrew-inset",
@@ -174,6 +175,7 @@ var extToMimeType = map[string]string{
 	".m4u":     "video/vnd.mpegurl",
 	".m4v":     "video/x-m4v",
 	".mac":     "image/x-macpaint",
+	".map":     "application/json",
 	".mathml":  "application/mathml+xml",
 	".mesh":    "model/mesh",
 	".mid":     "audio/midi",
@@ -190,6 +192,7 @@ var extToMimeType = map[string]string{
 	".nc":      "application/x-netcdf",
 	".oda":     "application/oda",
 	".ogv":     "video/ogv",
+	".otf":     "font/otf",
 	".pct":     "image/pict",
 	".pic":     "image/pict",
 	".pict":    "image/pict",
@@ -221,10 +224,13 @@ var extToMimeType = map[string]string{
 	".tif":     "image/tiff",
 	".tiff":    "image/tiff",
 	".tr":      "application/x-troff",
+	".ttf":     "font/ttf",
 	".txt":     "text/plain",
 	".vrml":    "model/vrml",
 	".vxml":    "application/voicexml+xml",
 	".webm":    "video/webm",
+	".woff":    "font/woff",
+	".woff2":   "font/woff2",
 	".wrl":     "model/vrml",
 	".xht":     "application/xhtml+xml",
 	".xhtml":   "application/xhtml+xml",
@@ -6,9 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"os"
 	"strconv"
 )
 
@@ -16,23 +14,51 @@ import (
 //
 // srcBucketName    source bucket name
 // srcObjectKey    source object name
-// destObjectKey    target object name in the form of bucketname.objectkey
+// destObjectKey    target object name. The target bucket is Bucket.BucketName.
 // partSize    the part size in byte.
-// options    object's contraints. Check out function InitiateMultipartUpload.
+// options    object's contraints. Check out function InitiateMultipartUpload. Routines, Checkpoint, CheckpointDir, CheckpointStorage and Progress are also valid.
 //
 // error    it's nil if the operation succeeds, otherwise it's an error object.
-//
-//	func (bucket Bucket) CopyFile(srcBucketName, srcObjectKey, destObjectKey string, partSize int64, options ...Option) error {
-//		destBucketName := bucket.BucketName
-//		if partSize < MinPartSize || partSize > MaxPartSize {
-//			return errors.New("oos: part size invalid range (1024KB, 5GB]")
-//		}
-//
-//		routines := getRoutines(options)
-//
-//		return bucket.copyFile(srcBucketName, srcObjectKey, destBucketName, destObjectKey,
-//			partSize, options, routines)
-//	}
+func (bucket Object) CopyFile(srcBucketName, srcObjectKey, destObjectKey string, partSize int64, options ...Option) error {
+	destBucketName := bucket.BucketName
+
+	if srcBucketName == "" {
+		return errors.New("the parameter is invalid: srcBucketName is empty")
+	}
+
+	if srcObjectKey == "" {
+		return errors.New("the parameter is invalid: srcObjectKey is empty")
+	}
+
+	if destObjectKey == "" {
+		return errors.New("the parameter is invalid: destObjectKey is empty")
+	}
+
+	if partSize < MinPartSize || partSize > MaxPartSize {
+		return errors.New("oos: part size invalid range (1024KB, 5GB]")
+	}
+
+	routines := getRoutines(options)
+
+	cpConf := getCpConfig(options)
+	if cpConf != nil && cpConf.IsEnable {
+		if store := getCheckpointStore(cpConf); store != nil {
+			cpName := getCopyCpName(srcBucketName, srcObjectKey, destBucketName, destObjectKey)
+			return bucket.copyFileWithCp(srcBucketName, srcObjectKey, destBucketName, destObjectKey, partSize, options, store, cpName, routines)
+		}
+	}
+
+	return bucket.copyFile(srcBucketName, srcObjectKey, destBucketName, destObjectKey,
+		partSize, options, routines)
+}
+
+// getCopyCpName returns the checkpoint name of copying the source object to the destination object
+func getCopyCpName(srcBucket, srcObject, destBucket, destObject string) string {
+	dest := fmt.Sprintf("oos://%v/%v", destBucket, destObject)
+	src := fmt.Sprintf("oos://%v/%v", srcBucket, srcObject)
+	return getCpFileName(src, dest)
+}
+
 func (bucket Object) CopyObjectAsMultipart(coypSrcList []SrcCopyPartObject, destBucketName, destObjectKey string, options ...Option) error {
 
 	if len(coypSrcList) == 0 {
@@ -70,10 +96,12 @@ func (bucket Object) CopyObjectAsMultipart(coypSrcList []SrcCopyPartObject, dest
 
 // copyWorkerArg defines the copy worker arguments
 type copyWorkerArg struct {
-	bucket  *Object
-	imur    InitiateMultipartUploadResult
-	options []Option
-	hook    copyPartHook
+	bucket        *Object
+	imur          InitiateMultipartUploadResult
+	srcBucketName string
+	srcObjectKey  string
+	options       []Option
+	hook          copyPartHook
 }
 
 // copyPartHook is the hook for testing purpose
@@ -103,6 +131,37 @@ func copyWorker(id int, arg copyWorkerArg, jobs <-chan SrcCopyPartObject, result
 	}
 }
 
+// copyRangeWorker copies the byte ranges of the source object
+func copyRangeWorker(id int, arg copyWorkerArg, jobs <-chan copyPart, results chan<- UploadPart, failed chan<- error, die <-chan bool) {
+	for chunk := range jobs {
+		if err := arg.hook(chunk); err != nil {
+			failed <- err
+			break
+		}
+		chunkSize := chunk.End - chunk.Start + 1
+		part, err := arg.bucket.UploadPartCopy(arg.imur, arg.srcBucketName, arg.srcObjectKey,
+			chunk.Start, chunkSize, chunk.Number, arg.options...)
+		if err != nil {
+			failed <- err
+			break
+		}
+		select {
+		case <-die:
+			return
+		default:
+		}
+		results <- part
+	}
+}
+
+// copyRangeScheduler
+func copyRangeScheduler(jobs chan copyPart, parts []copyPart) {
+	for _, part := range parts {
+		jobs <- part
+	}
+	close(jobs)
+}
+
 // copyScheduler
 func copyScheduler(jobs chan SrcCopyPartObject, parts []SrcCopyPartObject) {
 	for _, part := range parts {
@@ -170,7 +229,7 @@ func (bucket Object) copyObjectAsPartToMutliPart(copySrcList []SrcCopyPartObject
 	publishProgress(listener, event)
 
 	// Start to copy workers
-	arg := copyWorkerArg{descBucket, imur, payerOptions, copyPartHooker}
+	arg := copyWorkerArg{bucket: descBucket, imur: imur, options: payerOptions, hook: copyPartHooker}
 	for w := 1; w <= routines; w++ {
 		go copyWorker(w, arg, jobs, results, failed, die)
 	}
@@ -213,6 +272,103 @@ func (bucket Object) copyObjectAsPartToMutliPart(copySrcList []SrcCopyPartObject
 	return nil
 }
 
+// copyFile is a concurrently copy without checkpoint
+func (bucket Object) copyFile(srcBucketName, srcObjectKey, destBucketName, destObjectKey string,
+	partSize int64, options []Option, routines int) error {
+	descBucket, err := bucket.Bucket.Bucket(destBucketName)
+	if err != nil {
+		return err
+	}
+	srcBucket, err := bucket.Bucket.Bucket(srcBucketName)
+	if err != nil {
+		return err
+	}
+	listener := getProgressListener(options)
+
+	payerOptions := []Option{}
+	payer := getPayer(options)
+	if payer != "" {
+		payerOptions = append(payerOptions, RequestPayer(PayerType(payer)))
+	}
+
+	meta, err := srcBucket.HeadObject(srcObjectKey, payerOptions...)
+	if err != nil {
+		return err
+	}
+
+	objectSize, err := strconv.ParseInt(meta.Get(HTTPHeaderContentLength), 10, 0)
+	if err != nil {
+		return err
+	}
+
+	// Get copy parts
+	parts := getCopyParts(objectSize, partSize)
+	if len(parts) > MaxPartNum {
+		return errors.New("Too many parts, please increase part size")
+	}
+
+	// Initialize the multipart upload
+	imur, err := descBucket.InitiateMultipartUpload(destObjectKey, options...)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan copyPart, len(parts))
+	results := make(chan UploadPart, len(parts))
+	failed := make(chan error)
+	die := make(chan bool)
+
+	var completedBytes int64
+	totalBytes := getSrcObjectBytes(parts)
+	event := newProgressEvent(TransferStartedEvent, 0, totalBytes)
+	publishProgress(listener, event)
+
+	// Start to copy workers
+	arg := copyWorkerArg{descBucket, imur, srcBucketName, srcObjectKey, payerOptions, copyPartHooker}
+	for w := 1; w <= routines; w++ {
+		go copyRangeWorker(w, arg, jobs, results, failed, die)
+	}
+
+	// Start the scheduler
+	go copyRangeScheduler(jobs, parts)
+
+	// Wait for the parts finished.
+	completed := 0
+	ups := make([]UploadPart, len(parts))
+	for completed < len(parts) {
+		select {
+		case part := <-results:
+			completed++
+			ups[part.PartNumber-1] = part
+			copyBytes := (parts[part.PartNumber-1].End - parts[part.PartNumber-1].Start + 1)
+			completedBytes += copyBytes
+			event = newProgressEvent(TransferDataEvent, completedBytes, totalBytes)
+			publishProgress(listener, event)
+		case err := <-failed:
+			close(die)
+			descBucket.AbortMultipartUpload(imur, payerOptions...)
+			event = newProgressEvent(TransferFailedEvent, completedBytes, totalBytes)
+			publishProgress(listener, event)
+			return err
+		}
+
+		if completed >= len(parts) {
+			break
+		}
+	}
+
+	event = newProgressEvent(TransferCompletedEvent, completedBytes, totalBytes)
+	publishProgress(listener, event)
+
+	// Complete the multipart upload
+	_, err = descBucket.CompleteMultipartUpload(imur, ups, payerOptions...)
+	if err != nil {
+		descBucket.AbortMultipartUpload(imur, payerOptions...)
+		return err
+	}
+	return nil
+}
+
 // ----- Concurrently copy with checkpoint  -----
 
 const copyCpMagic = "84F1F18C-FF1D-403B-A1D8-9DEB5F65910A"
@@ -232,7 +388,7 @@ type copyCheckpoint struct {
 }
 
 // isValid checks if the data is valid which means CP is valid and object is not updated.
-func (cp copyCheckpoint) isValid(meta http.Header) (bool, error) {
+func (cp copyCheckpoint) isValid(meta http.Header, srcBucketName, srcObjectKey, destBucketName, destObjectKey string) (bool, error) {
 	// Compare CP's magic number and the MD5.
 	cpb := cp
 	cpb.MD5 = ""
@@ -240,7 +396,13 @@ func (cp copyCheckpoint) isValid(meta http.Header) (bool, error) {
 	sum := md5.Sum(js)
 	b64 := base64.StdEncoding.EncodeToString(sum[:])
 
-	if cp.Magic != downloadCpMagic || b64 != cp.MD5 {
+	if cp.Magic != copyCpMagic || b64 != cp.MD5 {
+		return false, nil
+	}
+
+	// The CP data may belong to another copy when the checkpoint file is specified.
+	if cp.SrcBucketName != srcBucketName || cp.SrcObjectKey != srcObjectKey ||
+		cp.DestBucketName != destBucketName || cp.DestObjectKey != destObjectKey {
 		return false, nil
 	}
 
@@ -259,9 +421,9 @@ func (cp copyCheckpoint) isValid(meta http.Header) (bool, error) {
 	return true, nil
 }
 
-// load loads from the checkpoint file
-func (cp *copyCheckpoint) load(filePath string) error {
-	contents, err := ioutil.ReadFile(filePath)
+// load loads from the checkpoint store
+func (cp *copyCheckpoint) load(store CheckpointStore, name string) error {
+	contents, err := store.Load(name)
 	if err != nil {
 		return err
 	}
@@ -276,8 +438,8 @@ func (cp *copyCheckpoint) update(part UploadPart) {
 	cp.PartStat[part.PartNumber-1] = true
 }
 
-// dump dumps the CP to the file
-func (cp *copyCheckpoint) dump(filePath string) error {
+// dump dumps the CP to the checkpoint store
+func (cp *copyCheckpoint) dump(store CheckpointStore, name string) error {
 	bcp := *cp
 
 	// Calculate MD5
@@ -297,7 +459,7 @@ func (cp *copyCheckpoint) dump(filePath string) error {
 	}
 
 	// Dump
-	return ioutil.WriteFile(filePath, js, FilePermMode)
+	return store.Save(name, js)
 }
 
 // todoParts returns unfinished parts
@@ -343,6 +505,9 @@ func (cp *copyCheckpoint) prepare(meta http.Header, srcBucket *Object, srcObject
 
 	// Parts
 	cp.Parts = getCopyParts(objectSize, partSize)
+	if len(cp.Parts) > MaxPartNum {
+		return errors.New("Too many parts, please increase part size")
+	}
 	cp.PartStat = make([]bool, len(cp.Parts))
 	for i := range cp.PartStat {
 		cp.PartStat[i] = false
@@ -359,13 +524,124 @@ func (cp *copyCheckpoint) prepare(meta http.Header, srcBucket *Object, srcObject
 	return nil
 }
 
-func (cp *copyCheckpoint) complete(bucket *Object, parts []UploadPart, cpFilePath string, options []Option) error {
+// abort aborts the multipart upload of the CP data which is not resumed, so that its copied parts are freed
+func (cp copyCheckpoint) abort(bucket *Object, options []Option) {
+	if cp.Magic != copyCpMagic || cp.CopyID == "" {
+		return
+	}
+	destBucket, err := bucket.Bucket.Bucket(cp.DestBucketName)
+	if err != nil {
+		return
+	}
+	imur := InitiateMultipartUploadResult{Bucket: cp.DestBucketName,
+		Key: cp.DestObjectKey, UploadID: cp.CopyID}
+	destBucket.AbortMultipartUpload(imur, options...)
+}
+
+func (cp *copyCheckpoint) complete(bucket *Object, parts []UploadPart, store CheckpointStore, cpName string, options []Option) error {
 	imur := InitiateMultipartUploadResult{Bucket: cp.DestBucketName,
 		Key: cp.DestObjectKey, UploadID: cp.CopyID}
 	_, err := bucket.CompleteMultipartUpload(imur, parts, options...)
 	if err != nil {
 		return err
 	}
-	os.Remove(cpFilePath)
+	store.Delete(cpName)
 	return err
 }
+
+// copyFileWithCp is concurrently copy with checkpoint
+func (bucket Object) copyFileWithCp(srcBucketName, srcObjectKey, destBucketName, destObjectKey string,
+	partSize int64, options []Option, store CheckpointStore, cpName string, routines int) error {
+	descBucket, err := bucket.Bucket.Bucket(destBucketName)
+	if err != nil {
+		return err
+	}
+	srcBucket, err := bucket.Bucket.Bucket(srcBucketName)
+	if err != nil {
+		return err
+	}
+	listener := getProgressListener(options)
+
+	payerOptions := []Option{}
+	payer := getPayer(options)
+	if payer != "" {
+		payerOptions = append(payerOptions, RequestPayer(PayerType(payer)))
+	}
+
+	// Load CP data
+	ccp := copyCheckpoint{}
+	err = ccp.load(store, cpName)
+	if err != nil {
+		store.Delete(cpName)
+	}
+
+	// Make sure the object is not updated.
+	meta, err := srcBucket.HeadObject(srcObjectKey, payerOptions...)
+	if err != nil {
+		return err
+	}
+
+	// Load error or the CP data is invalid---reinitialize
+	valid, err := ccp.isValid(meta, srcBucketName, srcObjectKey, destBucketName, destObjectKey)
+	if err != nil || !valid {
+		ccp.abort(&bucket, payerOptions)
+		if err = ccp.prepare(meta, srcBucket, srcObjectKey, descBucket, destObjectKey, partSize, options); err != nil {
+			return err
+		}
+		store.Delete(cpName)
+	}
+
+	// Unfinished parts
+	parts := ccp.todoParts()
+	imur := InitiateMultipartUploadResult{
+		Bucket:   destBucketName,
+		Key:      destObjectKey,
+		UploadID: ccp.CopyID}
+
+	jobs := make(chan copyPart, len(parts))
+	results := make(chan UploadPart, len(parts))
+	failed := make(chan error)
+	die := make(chan bool)
+
+	completedBytes := ccp.getCompletedBytes()
+	event := newProgressEvent(TransferStartedEvent, completedBytes, ccp.ObjStat.Size)
+	publishProgress(listener, event)
+
+	// Start the worker coroutines
+	arg := copyWorkerArg{descBucket, imur, srcBucketName, srcObjectKey, payerOptions, copyPartHooker}
+	for w := 1; w <= routines; w++ {
+		go copyRangeWorker(w, arg, jobs, results, failed, die)
+	}
+
+	// Start the scheduler
+	go copyRangeScheduler(jobs, parts)
+
+	// Wait for the parts completed.
+	completed := 0
+	for completed < len(parts) {
+		select {
+		case part := <-results:
+			completed++
+			ccp.update(part)
+			ccp.dump(store, cpName)
+			copyBytes := (ccp.Parts[part.PartNumber-1].End - ccp.Parts[part.PartNumber-1].Start + 1)
+			completedBytes += copyBytes
+			event = newProgressEvent(TransferDataEvent, completedBytes, ccp.ObjStat.Size)
+			publishProgress(listener, event)
+		case err := <-failed:
+			close(die)
+			event = newProgressEvent(TransferFailedEvent, completedBytes, ccp.ObjStat.Size)
+			publishProgress(listener, event)
+			return err
+		}
+
+		if completed >= len(parts) {
+			break
+		}
+	}
+
+	event = newProgressEvent(TransferCompletedEvent, completedBytes, ccp.ObjStat.Size)
+	publishProgress(listener, event)
+
+	return ccp.complete(descBucket, ccp.CopyParts, store, cpName, payerOptions)
+}
@@ -20,6 +20,8 @@ const (
 	deleteObjectsQuiet = "delete-objects-quiet"
 	routineNum         = "x-routine-num"
 	checkpointConfig   = "x-cp-config"
+	resumeUploadID     = "x-resume-upload-id"
+	fingerprintMode    = "x-fingerprint-mode"
 	progressListener   = "x-progress-listener"
 	storageClass       = "x-amz-storage-class"
 )
@@ -264,6 +266,7 @@ type cpConfig struct {
 	IsEnable bool
 	FilePath string
 	DirPath  string
+	Store    CheckpointStore
 }
 
 // Checkpoint sets the isEnable flag and checkpoint file path for DownloadFile/UploadFile.
@@ -276,6 +279,22 @@ func CheckpointDir(isEnable bool, dirPath string) Option {
 	return addArg(checkpointConfig, &cpConfig{IsEnable: isEnable, DirPath: dirPath})
 }
 
+// CheckpointStorage sets the checkpoint store for UploadFileWithCp/DownloadFileWithCp/CopyFile.
+func CheckpointStorage(store CheckpointStore) Option {
+	return addArg(checkpointConfig, &cpConfig{IsEnable: true, Store: store})
+}
+
+// ResumeUploadID sets the upload ID for UploadFileWithCp to resume, the checkpoint is rebuilt from the parts already uploaded.
+func ResumeUploadID(uploadID string) Option {
+	return addArg(resumeUploadID, uploadID)
+}
+
+// Fingerprint sets the fingerprint mode of the checkpoint created by UploadFileWithCp, by default it's FingerprintSampled.
+// The existing checkpoint is verified in the mode it's created with.
+func Fingerprint(mode FingerprintMode) Option {
+	return addArg(fingerprintMode, mode)
+}
+
 // Routines DownloadFile/UploadFile routine count
 func Routines(n int) Option {
 	return addArg(routineNum, n)
@@ -0,0 +1,608 @@
+package oos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PolicyVersion is the current version of the policy language
+	PolicyVersion = "2012-10-17"
+
+	// PolicyEffectAllow allows the matched requests
+	PolicyEffectAllow = "Allow"
+
+	// PolicyEffectDeny denies the matched requests
+	PolicyEffectDeny = "Deny"
+
+	// policyResourcePrefix is the ARN prefix of the bucket and object resources
+	policyResourcePrefix = "arn:aws:s3:::"
+)
+
+// policyVersions are the accepted versions of the policy language
+var policyVersions = []string{PolicyVersion, "2008-10-17"}
+
+// policyActions are the actions supported in the bucket policy
+var policyActions = []string{
+	"s3:GetObject", "s3:PutObject", "s3:DeleteObject", "s3:GetObjectAcl", "s3:PutObjectAcl",
+	"s3:ListBucket", "s3:ListBucketMultipartUploads", "s3:ListMultipartUploadParts", "s3:AbortMultipartUpload",
+	"s3:ListAllMyBuckets", "s3:DeleteBucket", "s3:GetBucketLocation", "s3:GetBucketAcl", "s3:PutBucketAcl",
+	"s3:GetBucketPolicy", "s3:PutBucketPolicy", "s3:DeleteBucketPolicy",
+	"s3:GetBucketWebsite", "s3:PutBucketWebsite", "s3:DeleteBucketWebsite",
+	"s3:GetBucketLogging", "s3:PutBucketLogging",
+	"s3:GetLifecycleConfiguration", "s3:PutLifecycleConfiguration",
+	"s3:GetBucketCORS", "s3:PutBucketCORS",
+	"s3:GetBucketObjectLockConfiguration", "s3:PutBucketObjectLockConfiguration",
+}
+
+// policyConditionOperators are the condition operators supported in the bucket policy
+var policyConditionOperators = []string{
+	"StringEquals", "StringNotEquals", "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase",
+	"StringLike", "StringNotLike",
+	"NumericEquals", "NumericNotEquals", "NumericLessThan", "NumericLessThanEquals",
+	"NumericGreaterThan", "NumericGreaterThanEquals",
+	"DateEquals", "DateNotEquals", "DateLessThan", "DateLessThanEquals", "DateGreaterThan", "DateGreaterThanEquals",
+	"Bool", "IpAddress", "NotIpAddress", "ArnEquals", "ArnNotEquals", "ArnLike", "ArnNotLike", "Null",
+}
+
+// Policy defines the bucket policy document
+type Policy struct {
+	Version   string      `json:"Version"`      // The policy language version, 2012-10-17
+	ID        string      `json:"Id,omitempty"` // The optional policy ID
+	Statement []Statement `json:"Statement"`    // The statements
+}
+
+// Statement defines a statement of the bucket policy
+type Statement struct {
+	Sid          string          `json:"Sid,omitempty"`          // The optional statement ID
+	Effect       string          `json:"Effect"`                 // Allow or Deny
+	Principal    *Principal      `json:"Principal,omitempty"`    // The users the statement applies to
+	NotPrincipal *Principal      `json:"NotPrincipal,omitempty"` // The users the statement does not apply to
+	Action       StringList      `json:"Action,omitempty"`       // The actions, such as s3:GetObject or s3:*
+	NotAction    StringList      `json:"NotAction,omitempty"`    // The actions excluded
+	Resource     StringList      `json:"Resource,omitempty"`     // The resources, such as arn:aws:s3:::bucket/*
+	NotResource  StringList      `json:"NotResource,omitempty"`  // The resources excluded
+	Condition    PolicyCondition `json:"Condition,omitempty"`    // The conditions
+}
+
+// Principal defines the users of a statement. "*" in the document is the same as {"AWS": "*"}.
+type Principal struct {
+	AWS StringList `json:"AWS"` // The user ARNs or *
+}
+
+// PolicyCondition maps the condition operator to the condition keys and values,
+// such as {"IpAddress": {"aws:SourceIp": ["192.168.0.0/16"]}}
+type PolicyCondition map[string]map[string]StringList
+
+// StringList is a list of strings, which is a single string or an array in the document
+type StringList []string
+
+// MarshalJSON marshals a single element list as a string
+func (s StringList) MarshalJSON() ([]byte, error) {
+	if len(s) == 1 {
+		return json.Marshal(s[0])
+	}
+	return json.Marshal([]string(s))
+}
+
+// UnmarshalJSON accepts a string or an array of strings, numbers and booleans are kept as strings
+func (s *StringList) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		items = []interface{}{v}
+	}
+	list := make(StringList, 0, len(items))
+	for _, item := range items {
+		switch value := item.(type) {
+		case string:
+			list = append(list, value)
+		case json.Number:
+			list = append(list, value.String())
+		case bool:
+			list = append(list, fmt.Sprint(value))
+		default:
+			return errors.New("expected a string or an array of strings")
+		}
+	}
+	*s = list
+	return nil
+}
+
+// UnmarshalJSON accepts "*" or an object with the AWS key
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		if single != "*" {
+			return fmt.Errorf("invalid principal %q, expected \"*\" or {\"AWS\": ...}", single)
+		}
+		p.AWS = StringList{"*"}
+		return nil
+	}
+	type principal Principal
+	var v principal
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid principal: %v", err)
+	}
+	*p = Principal(v)
+	return nil
+}
+
+// UnmarshalJSON accepts a single statement object or an array of statements
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	type policy struct {
+		Version   string          `json:"Version"`
+		ID        string          `json:"Id"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	var v policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	p.Version, p.ID, p.Statement = v.Version, v.ID, nil
+	raw := bytes.TrimSpace(v.Statement)
+	if len(raw) == 0 {
+		return nil
+	}
+	if raw[0] == '{' {
+		raw = append(append([]byte{'['}, raw...), ']')
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return err
+	}
+	for i, item := range items {
+		var s Statement
+		dec := json.NewDecoder(bytes.NewReader(item))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&s); err != nil {
+			return fmt.Errorf("statement %d: %v", i+1, err)
+		}
+		p.Statement = append(p.Statement, s)
+	}
+	return nil
+}
+
+// ParsePolicy parses the policy document. Unknown fields, such as a misspelled "Resouce", are rejected.
+//
+// text    the policy document in JSON.
+//
+// Policy    the parsed policy, valid when error is nil.
+// error    it's nil if no error, otherwise it's an error object.
+func ParsePolicy(text string) (Policy, error) {
+	var p Policy
+	if err := json.Unmarshal([]byte(text), &p); err != nil {
+		return p, fmt.Errorf("oos: invalid policy document: %v", err)
+	}
+	return p, nil
+}
+
+// Marshal marshals the policy to the compact JSON document
+func (p Policy) Marshal() (string, error) {
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+// PolicyValidationError contains all the problems found by Policy.Validate
+type PolicyValidationError struct {
+	Problems []string
+}
+
+// Error implements interface error
+func (e PolicyValidationError) Error() string {
+	return "oos: invalid policy: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the policy before it's uploaded.
+//
+// bucketName    if it's not empty, the resources must belong to the bucket.
+//
+// error    it's nil if the policy is valid, otherwise it's a PolicyValidationError.
+func (p Policy) Validate(bucketName string) error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !IsInRange(p.Version, policyVersions) {
+		add("Version must be %s", PolicyVersion)
+	}
+	if len(p.Statement) == 0 {
+		add("Statement is empty")
+	}
+
+	sids := map[string]bool{}
+	for i, s := range p.Statement {
+		name := fmt.Sprintf("statement %d", i+1)
+		if s.Sid != "" {
+			name = fmt.Sprintf("statement %d (%s)", i+1, s.Sid)
+			if sids[s.Sid] {
+				add("%s: duplicate Sid", name)
+			}
+			sids[s.Sid] = true
+		}
+
+		if s.Effect != PolicyEffectAllow && s.Effect != PolicyEffectDeny {
+			add("%s: Effect must be Allow or Deny, got %q", name, s.Effect)
+		}
+
+		if (s.Principal == nil) == (s.NotPrincipal == nil) {
+			add("%s: exactly one of Principal and NotPrincipal is required", name)
+		}
+		for _, principal := range []*Principal{s.Principal, s.NotPrincipal} {
+			if principal != nil && len(principal.AWS) == 0 {
+				add("%s: Principal is empty", name)
+			}
+		}
+
+		if (len(s.Action) == 0) == (len(s.NotAction) == 0) {
+			add("%s: exactly one of Action and NotAction is required", name)
+		}
+		for _, action := range append(append(StringList{}, s.Action...), s.NotAction...) {
+			if !isValidPolicyAction(action) {
+				add("%s: unknown action %q", name, action)
+			}
+		}
+
+		if (len(s.Resource) == 0) == (len(s.NotResource) == 0) {
+			add("%s: exactly one of Resource and NotResource is required", name)
+		}
+		for _, resource := range append(append(StringList{}, s.Resource...), s.NotResource...) {
+			if resource == "*" {
+				continue
+			}
+			if !strings.HasPrefix(resource, policyResourcePrefix) {
+				add("%s: resource %q must start with %s", name, resource, policyResourcePrefix)
+				continue
+			}
+			bucket := strings.SplitN(strings.TrimPrefix(resource, policyResourcePrefix), "/", 2)[0]
+			if bucketName != "" && !MatchWildcard(bucket, bucketName) {
+				add("%s: resource %q does not belong to bucket %s", name, resource, bucketName)
+			}
+		}
+
+		for _, operator := range sortedKeys(s.Condition) {
+			conditions := s.Condition[operator]
+			if !IsInRange(strings.TrimSuffix(operator, "IfExists"), policyConditionOperators) {
+				add("%s: unknown condition operator %q", name, operator)
+				continue
+			}
+			for _, key := range sortedKeys(conditions) {
+				values := conditions[key]
+				if len(values) == 0 {
+					add("%s: condition %s %s has no value", name, operator, key)
+				}
+				if operator == "IpAddress" || operator == "NotIpAddress" {
+					for _, value := range values {
+						if !isValidIPOrCIDR(value) {
+							add("%s: condition %s %s has invalid IP %q", name, operator, key, value)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return PolicyValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the condition map in order, so that the problems are reported in a stable order
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch v := m.(type) {
+	case PolicyCondition:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	case map[string]StringList:
+		for k := range v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// isValidPolicyAction checks the action is * or matches at least one supported action
+func isValidPolicyAction(action string) bool {
+	if action == "*" {
+		return true
+	}
+	for _, known := range policyActions {
+		if MatchWildcard(strings.ToLower(action), strings.ToLower(known)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidIPOrCIDR(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
+
+// MatchWildcard reports whether s matches the pattern, in which * matches any sequence of characters
+// and ? matches any single character.
+func MatchWildcard(pattern, s string) bool {
+	p, i := 0, 0
+	star, match := -1, 0
+	for i < len(s) {
+		if p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]) {
+			p++
+			i++
+		} else if p < len(pattern) && pattern[p] == '*' {
+			star, match = p, i
+			p++
+		} else if star >= 0 {
+			p = star + 1
+			match++
+			i = match
+		} else {
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// PolicyRequest describes a request evaluated by Policy.Evaluate
+type PolicyRequest struct {
+	Principal string            // The requester's ARN, empty for anonymous requests
+	Action    string            // The action, such as s3:GetObject
+	Bucket    string            // The bucket name
+	Key       string            // The object key, empty for bucket operations
+	SourceIP  string            // The aws:SourceIp condition key
+	Referer   string            // The aws:Referer condition key
+	Context   map[string]string // Other condition keys, such as s3:prefix or aws:SecureTransport
+}
+
+// Resource returns the ARN of the bucket or object
+func (r PolicyRequest) Resource() string {
+	if r.Key == "" {
+		return policyResourcePrefix + r.Bucket
+	}
+	return policyResourcePrefix + r.Bucket + "/" + r.Key
+}
+
+// conditionValue looks up the condition key case-insensitively
+func (r PolicyRequest) conditionValue(key string) (string, bool) {
+	switch strings.ToLower(key) {
+	case "aws:sourceip":
+		return r.SourceIP, r.SourceIP != ""
+	case "aws:referer":
+		return r.Referer, r.Referer != ""
+	}
+	for k, v := range r.Context {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// PolicyDecision is the result of Policy.Evaluate
+type PolicyDecision struct {
+	Effect    string     // Allow or Deny
+	Statement *Statement // The statement deciding the result, nil if no statement matches (implicit deny)
+	Index     int        // The index of the statement, starting from 1, 0 if no statement matches
+}
+
+// Allowed reports whether the request is allowed
+func (d PolicyDecision) Allowed() bool {
+	return d.Effect == PolicyEffectAllow
+}
+
+// Evaluate evaluates the request against the policy locally.
+//
+// An explicit Deny overrides any Allow. If no statement matches, the request is implicitly denied.
+//
+// req    the request to evaluate.
+//
+// PolicyDecision    the decision and the statement deciding it.
+func (p Policy) Evaluate(req PolicyRequest) PolicyDecision {
+	allow := PolicyDecision{Effect: PolicyEffectDeny}
+	for i := range p.Statement {
+		s := &p.Statement[i]
+		if !s.matches(req) {
+			continue
+		}
+		if s.Effect == PolicyEffectDeny {
+			return PolicyDecision{Effect: PolicyEffectDeny, Statement: s, Index: i + 1}
+		}
+		if s.Effect == PolicyEffectAllow && allow.Statement == nil {
+			allow = PolicyDecision{Effect: PolicyEffectAllow, Statement: s, Index: i + 1}
+		}
+	}
+	return allow
+}
+
+// matches reports whether the statement applies to the request
+func (s Statement) matches(req PolicyRequest) bool {
+	principal := req.Principal
+	if principal == "" {
+		principal = "*"
+	}
+	if s.Principal != nil && !matchPrincipal(s.Principal, principal) {
+		return false
+	}
+	if s.NotPrincipal != nil && matchPrincipal(s.NotPrincipal, principal) {
+		return false
+	}
+
+	action := strings.ToLower(req.Action)
+	if len(s.Action) > 0 && !matchAny(s.Action, action, true) {
+		return false
+	}
+	if len(s.NotAction) > 0 && matchAny(s.NotAction, action, true) {
+		return false
+	}
+
+	resource := req.Resource()
+	if len(s.Resource) > 0 && !matchAny(s.Resource, resource, false) {
+		return false
+	}
+	if len(s.NotResource) > 0 && matchAny(s.NotResource, resource, false) {
+		return false
+	}
+
+	for operator, conditions := range s.Condition {
+		for key, values := range conditions {
+			if !evalCondition(operator, key, values, req) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchPrincipal(p *Principal, principal string) bool {
+	for _, v := range p.AWS {
+		if v == "*" || MatchWildcard(v, principal) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns StringList, s string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if MatchWildcard(pattern, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// evalCondition evaluates a condition key, it's satisfied if any of the values matches.
+// For the negated operators, it's satisfied if none of the values matches.
+func evalCondition(operator, key string, values StringList, req PolicyRequest) bool {
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	operator = strings.TrimSuffix(operator, "IfExists")
+	value, exists := req.conditionValue(key)
+
+	if operator == "Null" {
+		for _, v := range values {
+			if strings.EqualFold(v, "true") != exists {
+				return true
+			}
+		}
+		return false
+	}
+
+	negated := strings.Contains(operator, "Not")
+	if !exists {
+		// A missing key satisfies the negated operators and the ...IfExists operators
+		return ifExists || negated
+	}
+
+	var match func(v string) bool
+	switch strings.Replace(operator, "Not", "", 1) {
+	case "StringEquals", "ArnEquals":
+		match = func(v string) bool { return v == value }
+	case "StringEqualsIgnoreCase":
+		match = func(v string) bool { return strings.EqualFold(v, value) }
+	case "StringLike", "ArnLike":
+		match = func(v string) bool { return MatchWildcard(v, value) }
+	case "Bool":
+		match = func(v string) bool { return strings.EqualFold(v, value) }
+	case "IpAddress":
+		ip := net.ParseIP(value)
+		match = func(v string) bool {
+			if !strings.Contains(v, "/") {
+				return ip != nil && ip.Equal(net.ParseIP(v))
+			}
+			_, ipNet, err := net.ParseCIDR(v)
+			return err == nil && ip != nil && ipNet.Contains(ip)
+		}
+	case "NumericEquals", "NumericLessThan", "NumericLessThanEquals", "NumericGreaterThan", "NumericGreaterThanEquals":
+		x, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return false
+		}
+		match = func(v string) bool {
+			y, err := strconv.ParseFloat(v, 64)
+			return err == nil && compareResult(operator, compareFloat(x, y))
+		}
+	case "DateEquals", "DateLessThan", "DateLessThanEquals", "DateGreaterThan", "DateGreaterThanEquals":
+		x, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return false
+		}
+		match = func(v string) bool {
+			y, err := time.Parse(time.RFC3339, v)
+			return err == nil && compareResult(operator, compareTime(x, y))
+		}
+	default:
+		return false
+	}
+
+	matched := false
+	for _, v := range values {
+		if match(v) {
+			matched = true
+			break
+		}
+	}
+	return matched != negated
+}
+
+func compareTime(x, y time.Time) int {
+	switch {
+	case x.Before(y):
+		return -1
+	case x.After(y):
+		return 1
+	}
+	return 0
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareResult checks the comparison result of the request value and the policy value for the operator
+func compareResult(operator string, c int) bool {
+	switch {
+	case strings.HasSuffix(operator, "LessThanEquals"):
+		return c <= 0
+	case strings.HasSuffix(operator, "LessThan"):
+		return c < 0
+	case strings.HasSuffix(operator, "GreaterThanEquals"):
+		return c >= 0
+	case strings.HasSuffix(operator, "GreaterThan"):
+		return c > 0
+	}
+	return c == 0
+}
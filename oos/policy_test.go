@@ -0,0 +1,327 @@
+package oos
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*.jpg", "photos/a.jpg", true},
+		{"*.jpg", "photos/a.jpg.bak", false},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket/a/b", true},
+		{"arn:aws:s3:::bucket/*", "arn:aws:s3:::bucket", false},
+		{"arn:aws:s3:::bucket*", "arn:aws:s3:::bucket-old/a", true},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b*", "xxbxxaxx", false},
+		{"a**", "a", true},
+	}
+	for _, tt := range tests {
+		if got := MatchWildcard(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("MatchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestEvalCondition(t *testing.T) {
+	req := PolicyRequest{
+		SourceIP: "192.168.1.10",
+		Referer:  "https://www.example.com/page",
+		Context: map[string]string{
+			"s3:prefix":           "home/alice/",
+			"aws:SecureTransport": "false",
+			"s3:max-keys":         "100",
+			"aws:CurrentTime":     "2024-06-01T00:00:00Z",
+		},
+	}
+	tests := []struct {
+		name     string
+		operator string
+		key      string
+		values   StringList
+		want     bool
+	}{
+		{"string equals", "StringEquals", "s3:prefix", StringList{"home/alice/"}, true},
+		{"string equals any value", "StringEquals", "s3:prefix", StringList{"home/bob/", "home/alice/"}, true},
+		{"string equals case sensitive", "StringEquals", "s3:prefix", StringList{"HOME/alice/"}, false},
+		{"string equals ignore case", "StringEqualsIgnoreCase", "s3:prefix", StringList{"HOME/ALICE/"}, true},
+		{"key is case insensitive", "StringEquals", "S3:Prefix", StringList{"home/alice/"}, true},
+		{"string not equals", "StringNotEquals", "s3:prefix", StringList{"home/bob/"}, true},
+		{"string not equals any value", "StringNotEquals", "s3:prefix", StringList{"home/bob/", "home/alice/"}, false},
+		{"string not equals missing key", "StringNotEquals", "s3:delimiter", StringList{"/"}, true},
+		{"string equals missing key", "StringEquals", "s3:delimiter", StringList{"/"}, false},
+		{"string like", "StringLike", "aws:Referer", StringList{"https://www.example.com/*"}, true},
+		{"string like question mark", "StringLike", "s3:prefix", StringList{"home/?lice/"}, true},
+		{"string like no match", "StringLike", "aws:Referer", StringList{"https://example.com/*"}, false},
+		{"string not like", "StringNotLike", "aws:Referer", StringList{"https://example.com/*"}, true},
+		{"string not like match", "StringNotLike", "aws:Referer", StringList{"*.example.com/*"}, false},
+		{"if exists missing key", "StringEqualsIfExists", "s3:delimiter", StringList{"/"}, true},
+		{"if exists present key", "StringEqualsIfExists", "s3:prefix", StringList{"home/bob/"}, false},
+		{"if exists present key match", "StringLikeIfExists", "s3:prefix", StringList{"home/*"}, true},
+		{"not if exists missing key", "StringNotEqualsIfExists", "s3:delimiter", StringList{"/"}, true},
+		{"null true missing key", "Null", "s3:delimiter", StringList{"true"}, true},
+		{"null true present key", "Null", "s3:prefix", StringList{"true"}, false},
+		{"null false present key", "Null", "s3:prefix", StringList{"false"}, true},
+		{"null false missing key", "Null", "s3:delimiter", StringList{"false"}, false},
+		{"null empty source ip", "Null", "aws:SourceIp", StringList{"false"}, true},
+		{"bool", "Bool", "aws:SecureTransport", StringList{"false"}, true},
+		{"bool no match", "Bool", "aws:SecureTransport", StringList{"true"}, false},
+		{"ip cidr", "IpAddress", "aws:SourceIp", StringList{"192.168.0.0/16"}, true},
+		{"ip single", "IpAddress", "aws:SourceIp", StringList{"192.168.1.10"}, true},
+		{"ip outside", "IpAddress", "aws:SourceIp", StringList{"10.0.0.0/8"}, false},
+		{"not ip outside", "NotIpAddress", "aws:SourceIp", StringList{"10.0.0.0/8"}, true},
+		{"not ip inside", "NotIpAddress", "aws:SourceIp", StringList{"10.0.0.0/8", "192.168.1.0/24"}, false},
+		{"numeric less than equals", "NumericLessThanEquals", "s3:max-keys", StringList{"100"}, true},
+		{"numeric less than", "NumericLessThan", "s3:max-keys", StringList{"100"}, false},
+		{"numeric greater than", "NumericGreaterThan", "s3:max-keys", StringList{"10"}, true},
+		{"numeric not equals", "NumericNotEquals", "s3:max-keys", StringList{"100"}, false},
+		{"date less than", "DateLessThan", "aws:CurrentTime", StringList{"2025-01-01T00:00:00Z"}, true},
+		{"date greater than", "DateGreaterThan", "aws:CurrentTime", StringList{"2025-01-01T00:00:00Z"}, false},
+		{"unknown operator", "StringMatches", "s3:prefix", StringList{"home/alice/"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evalCondition(tt.operator, tt.key, tt.values, req); got != tt.want {
+				t.Errorf("evalCondition(%s, %s, %v) = %v, want %v", tt.operator, tt.key, tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	policy, err := ParsePolicy(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{
+				"Sid": "PublicRead",
+				"Effect": "Allow",
+				"Principal": "*",
+				"Action": "s3:GetObject",
+				"Resource": "arn:aws:s3:::bucket/public/*"
+			},
+			{
+				"Sid": "DenyPrivate",
+				"Effect": "Deny",
+				"Principal": "*",
+				"Action": "s3:*",
+				"Resource": "arn:aws:s3:::bucket/public/private/*"
+			},
+			{
+				"Sid": "AdminAll",
+				"Effect": "Allow",
+				"Principal": {"AWS": "arn:aws:iam::123456:user/admin*"},
+				"Action": "s3:*",
+				"Resource": ["arn:aws:s3:::bucket", "arn:aws:s3:::bucket/*"]
+			},
+			{
+				"Sid": "OfficeUpload",
+				"Effect": "Allow",
+				"Principal": "*",
+				"Action": ["s3:PutObject"],
+				"Resource": "arn:aws:s3:::bucket/upload/*",
+				"Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+			},
+			{
+				"Sid": "NoDeleteOutsideOffice",
+				"Effect": "Deny",
+				"Principal": "*",
+				"NotAction": ["s3:GetObject", "s3:ListBucket"],
+				"Resource": "arn:aws:s3:::bucket/upload/*",
+				"Condition": {"NotIpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+			}
+		]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		req    PolicyRequest
+		effect string
+		index  int
+	}{
+		{"anonymous public read", PolicyRequest{Action: "s3:GetObject", Bucket: "bucket", Key: "public/a.jpg"}, PolicyEffectAllow, 1},
+		{"action is case insensitive", PolicyRequest{Action: "S3:GETOBJECT", Bucket: "bucket", Key: "public/a.jpg"}, PolicyEffectAllow, 1},
+		{"resource is case sensitive", PolicyRequest{Action: "s3:GetObject", Bucket: "bucket", Key: "Public/a.jpg"}, PolicyEffectDeny, 0},
+		{"anonymous write denied implicitly", PolicyRequest{Action: "s3:PutObject", Bucket: "bucket", Key: "public/a.jpg"}, PolicyEffectDeny, 0},
+		{"deny overrides allow", PolicyRequest{Action: "s3:GetObject", Bucket: "bucket", Key: "public/private/a.jpg"}, PolicyEffectDeny, 2},
+		{"deny applies to admin", PolicyRequest{Principal: "arn:aws:iam::123456:user/admin", Action: "s3:GetObject", Bucket: "bucket", Key: "public/private/a.jpg"}, PolicyEffectDeny, 2},
+		{"principal wildcard", PolicyRequest{Principal: "arn:aws:iam::123456:user/admin2", Action: "s3:DeleteObject", Bucket: "bucket", Key: "a.txt"}, PolicyEffectAllow, 3},
+		{"principal mismatch", PolicyRequest{Principal: "arn:aws:iam::123456:user/guest", Action: "s3:DeleteObject", Bucket: "bucket", Key: "a.txt"}, PolicyEffectDeny, 0},
+		{"bucket resource", PolicyRequest{Principal: "arn:aws:iam::123456:user/admin", Action: "s3:ListBucket", Bucket: "bucket"}, PolicyEffectAllow, 3},
+		{"other bucket", PolicyRequest{Principal: "arn:aws:iam::123456:user/admin", Action: "s3:ListBucket", Bucket: "bucket2"}, PolicyEffectDeny, 0},
+		{"condition satisfied", PolicyRequest{Action: "s3:PutObject", Bucket: "bucket", Key: "upload/a.txt", SourceIP: "10.1.2.3"}, PolicyEffectAllow, 4},
+		{"condition not satisfied", PolicyRequest{Action: "s3:PutObject", Bucket: "bucket", Key: "upload/a.txt", SourceIP: "172.16.0.1"}, PolicyEffectDeny, 5},
+		{"missing source ip satisfies negated", PolicyRequest{Action: "s3:DeleteObject", Bucket: "bucket", Key: "upload/a.txt"}, PolicyEffectDeny, 5},
+		{"not action excluded", PolicyRequest{Action: "s3:GetObject", Bucket: "bucket", Key: "upload/a.txt", SourceIP: "172.16.0.1"}, PolicyEffectDeny, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := policy.Evaluate(tt.req)
+			if d.Effect != tt.effect || d.Index != tt.index {
+				t.Errorf("Evaluate() = %s by statement %d, want %s by statement %d", d.Effect, d.Index, tt.effect, tt.index)
+			}
+			if d.Allowed() != (tt.effect == PolicyEffectAllow) {
+				t.Errorf("Allowed() = %v, want %v", d.Allowed(), tt.effect == PolicyEffectAllow)
+			}
+			if (d.Statement == nil) != (tt.index == 0) {
+				t.Errorf("Statement = %v, want statement %d", d.Statement, tt.index)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		statements int
+		valid      bool
+	}{
+		{"single statement", `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}}`, 1, true},
+		{"statement array", `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Principal": {"AWS": ["arn:aws:iam::123456:user/a"]}, "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::bucket/*"]}]}`, 1, true},
+		{"condition numbers and booleans", `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:ListBucket", "Resource": "arn:aws:s3:::bucket", "Condition": {"NumericLessThan": {"s3:max-keys": 100}, "Bool": {"aws:SecureTransport": true}}}}`, 1, true},
+		{"misspelled field", `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resouce": "arn:aws:s3:::bucket/*"}}`, 0, false},
+		{"unknown top level field", `{"Version": "2012-10-17", "Statements": []}`, 0, false},
+		{"principal other than *", `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": "admin", "Action": "s3:GetObject", "Resource": "*"}}`, 0, false},
+		{"principal with unknown key", `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": {"User": "admin"}, "Action": "s3:GetObject", "Resource": "*"}}`, 0, false},
+		{"invalid json", `{"Version": "2012-10-17",`, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy(tt.text)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ParsePolicy() error = %v, want valid %v", err, tt.valid)
+			}
+			if len(p.Statement) != tt.statements {
+				t.Errorf("ParsePolicy() returned %d statements, want %d", len(p.Statement), tt.statements)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	valid := func() Statement {
+		return Statement{
+			Sid:       "Read",
+			Effect:    PolicyEffectAllow,
+			Principal: &Principal{AWS: StringList{"*"}},
+			Action:    StringList{"s3:GetObject"},
+			Resource:  StringList{"arn:aws:s3:::bucket/*"},
+		}
+	}
+	tests := []struct {
+		name     string
+		version  string
+		bucket   string
+		modify   func(s *Statement)
+		problems []string
+	}{
+		{"valid", PolicyVersion, "bucket", nil, nil},
+		{"old version", "2008-10-17", "bucket", nil, nil},
+		{"any bucket", PolicyVersion, "", func(s *Statement) { s.Resource = StringList{"arn:aws:s3:::other/*"} }, nil},
+		{"bucket wildcard", PolicyVersion, "bucket", func(s *Statement) { s.Resource = StringList{"arn:aws:s3:::buck*"} }, nil},
+		{"all resources", PolicyVersion, "bucket", func(s *Statement) { s.Resource = StringList{"*"} }, nil},
+		{"action wildcard", PolicyVersion, "bucket", func(s *Statement) { s.Action = StringList{"s3:Get*", "*"} }, nil},
+		{"not principal", PolicyVersion, "bucket", func(s *Statement) {
+			s.Principal, s.NotPrincipal = nil, &Principal{AWS: StringList{"arn:aws:iam::123456:user/a"}}
+		}, nil},
+		{"condition", PolicyVersion, "bucket", func(s *Statement) {
+			s.Condition = PolicyCondition{"IpAddressIfExists": {"aws:SourceIp": {"10.0.0.0/8", "192.168.1.1"}}}
+		}, nil},
+		{"invalid version", "2024-01-01", "bucket", nil, []string{"Version must be 2012-10-17"}},
+		{"invalid effect", PolicyVersion, "bucket", func(s *Statement) { s.Effect = "allow" },
+			[]string{`statement 1 (Read): Effect must be Allow or Deny, got "allow"`}},
+		{"missing principal", PolicyVersion, "bucket", func(s *Statement) { s.Principal = nil },
+			[]string{"statement 1 (Read): exactly one of Principal and NotPrincipal is required"}},
+		{"empty principal", PolicyVersion, "bucket", func(s *Statement) { s.Principal = &Principal{} },
+			[]string{"statement 1 (Read): Principal is empty"}},
+		{"both action and not action", PolicyVersion, "bucket", func(s *Statement) { s.NotAction = StringList{"s3:PutObject"} },
+			[]string{"statement 1 (Read): exactly one of Action and NotAction is required"}},
+		{"unknown action", PolicyVersion, "bucket", func(s *Statement) { s.Action = StringList{"s3:GetObjects"} },
+			[]string{`statement 1 (Read): unknown action "s3:GetObjects"`}},
+		{"missing resource", PolicyVersion, "bucket", func(s *Statement) { s.Resource = nil },
+			[]string{"statement 1 (Read): exactly one of Resource and NotResource is required"}},
+		{"resource without arn", PolicyVersion, "bucket", func(s *Statement) { s.Resource = StringList{"bucket/*"} },
+			[]string{`statement 1 (Read): resource "bucket/*" must start with arn:aws:s3:::`}},
+		{"resource of another bucket", PolicyVersion, "bucket", func(s *Statement) { s.Resource = StringList{"arn:aws:s3:::bucket2/*"} },
+			[]string{`statement 1 (Read): resource "arn:aws:s3:::bucket2/*" does not belong to bucket bucket`}},
+		{"unknown condition operator", PolicyVersion, "bucket", func(s *Statement) {
+			s.Condition = PolicyCondition{"StringMatches": {"s3:prefix": {"home/"}}}
+		}, []string{`statement 1 (Read): unknown condition operator "StringMatches"`}},
+		{"condition without value", PolicyVersion, "bucket", func(s *Statement) {
+			s.Condition = PolicyCondition{"StringEquals": {"s3:prefix": {}}}
+		}, []string{"statement 1 (Read): condition StringEquals s3:prefix has no value"}},
+		{"invalid ip", PolicyVersion, "bucket", func(s *Statement) {
+			s.Condition = PolicyCondition{"NotIpAddress": {"aws:SourceIp": {"10.0.0.0/33"}}}
+		}, []string{`statement 1 (Read): condition NotIpAddress aws:SourceIp has invalid IP "10.0.0.0/33"`}},
+		{"all problems reported", PolicyVersion, "bucket", func(s *Statement) {
+			s.Sid, s.Effect, s.Action = "", "Permit", nil
+		}, []string{
+			`statement 1: Effect must be Allow or Deny, got "Permit"`,
+			"statement 1: exactly one of Action and NotAction is required",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			if tt.modify != nil {
+				tt.modify(&s)
+			}
+			err := Policy{Version: tt.version, Statement: []Statement{s}}.Validate(tt.bucket)
+			if tt.problems == nil {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			e, ok := err.(PolicyValidationError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want a PolicyValidationError", err)
+			}
+			if strings.Join(e.Problems, "\n") != strings.Join(tt.problems, "\n") {
+				t.Errorf("Validate() problems = %q, want %q", e.Problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestPolicyValidateStatements(t *testing.T) {
+	statement := Statement{
+		Sid:       "Read",
+		Effect:    PolicyEffectAllow,
+		Principal: &Principal{AWS: StringList{"*"}},
+		Action:    StringList{"s3:GetObject"},
+		Resource:  StringList{"arn:aws:s3:::bucket/*"},
+	}
+	tests := []struct {
+		name       string
+		statements []Statement
+		problems   []string
+	}{
+		{"no statement", nil, []string{"Statement is empty"}},
+		{"duplicate sid", []Statement{statement, statement}, []string{"statement 2 (Read): duplicate Sid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Policy{Version: PolicyVersion, Statement: tt.statements}.Validate("bucket")
+			e, ok := err.(PolicyValidationError)
+			if !ok || strings.Join(e.Problems, "\n") != strings.Join(tt.problems, "\n") {
+				t.Errorf("Validate() = %v, want %q", err, tt.problems)
+			}
+		})
+	}
+}
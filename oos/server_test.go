@@ -0,0 +1,146 @@
+package oos
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testServer is an in-memory OOS server with the object and multipart upload APIs used by the tests
+type testServer struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	uploads  map[string]map[int][]byte
+	requests map[string]int
+	seq      int
+}
+
+// newTestBucket starts a testServer and returns the bucket bk on it, the server is closed when the test ends
+func newTestBucket(t *testing.T) (*Object, *testServer) {
+	t.Helper()
+	s := &testServer{objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}, requests: map[string]int{}}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	client, err := New(ts.URL, "ak", "sk", V4Signature(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bucket, err := client.Bucket("bk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bucket, s
+}
+
+// hexMD5 returns the hex MD5 of the data, it's the ETag of a part
+func hexMD5(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// initiate creates an upload with the parts
+func (s *testServer) initiate(parts map[int][]byte) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	id := fmt.Sprintf("upload-%d", s.seq)
+	s.uploads[id] = map[int][]byte{}
+	for n, data := range parts {
+		s.uploads[id][n] = data
+	}
+	return id
+}
+
+// count returns the number of requests of the operation
+func (s *testServer) count(op string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[op]
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bk/")
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	_, initiate := q["uploads"]
+	id := q.Get("uploadId")
+	parts := s.uploads[id]
+	if id != "" && parts == nil {
+		s.writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && initiate:
+		s.requests["InitiateMultipartUpload"]++
+		s.seq++
+		id = fmt.Sprintf("upload-%d", s.seq)
+		s.uploads[id] = map[int][]byte{}
+		s.writeXML(w, InitiateMultipartUploadResult{Bucket: "bk", Key: key, UploadID: id})
+	case r.Method == http.MethodPut && id != "":
+		s.requests["UploadPart"]++
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		parts[n] = body
+		w.Header().Set(HTTPHeaderEtag, `"`+hexMD5(body)+`"`)
+	case r.Method == http.MethodPost && id != "":
+		s.requests["CompleteMultipartUpload"]++
+		var complete completeMultipartUploadXML
+		xml.Unmarshal(body, &complete)
+		var data []byte
+		for _, part := range complete.Part {
+			if `"`+hexMD5(parts[part.PartNumber])+`"` != part.ETag {
+				s.writeError(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		s.objects[key] = data
+		delete(s.uploads, id)
+		s.writeXML(w, CompleteMultipartUploadResult{Bucket: "bk", Key: key})
+	case r.Method == http.MethodGet && id != "":
+		s.requests["ListUploadedParts"]++
+		result := ListUploadedPartsResult{Bucket: "bk", Key: key, UploadID: id}
+		for n, data := range parts {
+			result.UploadedParts = append(result.UploadedParts, UploadedPart{PartNumber: n, ETag: `"` + hexMD5(data) + `"`, Size: len(data)})
+		}
+		sort.Slice(result.UploadedParts, func(i, j int) bool {
+			return result.UploadedParts[i].PartNumber < result.UploadedParts[j].PartNumber
+		})
+		s.writeXML(w, result)
+	case r.Method == http.MethodDelete && id != "":
+		s.requests["AbortMultipartUpload"]++
+		delete(s.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.requests["PutObject"]++
+		s.objects[key] = body
+		w.Header().Set(HTTPHeaderEtag, `"`+hexMD5(body)+`"`)
+	default:
+		s.writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (s *testServer) writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set(HTTPHeaderContentType, "application/xml")
+	data, _ := xml.Marshal(v)
+	w.Write(data)
+}
+
+func (s *testServer) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set(HTTPHeaderContentType, "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message><RequestId>test</RequestId></Error>", code, code)
+}
@@ -0,0 +1,104 @@
+package oos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// UploadStream uploads the data of unknown length from reader, such as stdin or a pipe.
+//
+// The data is buffered one part at a time. If the data is shorter than a part it is uploaded by
+// PutObject, otherwise a multipart upload is used and aborted on error. Since the total size is
+// unknown, TotalBytes of the progress events is always 0.
+//
+// objectKey    the object name.
+// reader    the data source, it's read until io.EOF.
+// partSize    the part size in byte, the data can not exceed partSize * MaxPartNum.
+// options    the options for uploading object.
+//
+// error    it's nil if the operation succeeds, otherwise it's an error object.
+func (bucket Object) UploadStream(objectKey string, reader io.Reader, partSize int64, options ...Option) error {
+	if objectKey == "" {
+		return errors.New("the parameter is invalid: ObjectKey is empty")
+	}
+
+	if reader == nil {
+		return errors.New("the parameter is invalid: reader is nil")
+	}
+
+	if partSize < MinPartSize || partSize > MaxPartSize {
+		return errors.New("oos: part size invalid range (1024KB, 5GB]")
+	}
+
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(reader, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return bucket.PutObject(objectKey, bytes.NewReader(buf[:n]), options...)
+	}
+	if err != nil {
+		return err
+	}
+
+	return bucket.uploadStream(objectKey, reader, buf, options)
+}
+
+// uploadStream uploads the first part in buf and the rest of reader part by part
+func (bucket Object) uploadStream(objectKey string, reader io.Reader, buf []byte, options []Option) error {
+	listener := getProgressListener(options)
+
+	payerOptions := []Option{}
+	payer := getPayer(options)
+	if payer != "" {
+		payerOptions = append(payerOptions, RequestPayer(PayerType(payer)))
+	}
+
+	// Initialize the multipart upload
+	imur, err := bucket.InitiateMultipartUpload(objectKey, options...)
+	if err != nil {
+		return err
+	}
+
+	var completedBytes int64
+	event := newProgressEvent(TransferStartedEvent, 0, 0)
+	publishProgress(listener, event)
+
+	abort := func(err error) error {
+		event = newProgressEvent(TransferFailedEvent, completedBytes, 0)
+		publishProgress(listener, event)
+		bucket.AbortMultipartUpload(imur, payerOptions...)
+		return err
+	}
+
+	var parts []UploadPart
+	n := len(buf)
+	for n > 0 {
+		if len(parts) >= MaxPartNum {
+			return abort(fmt.Errorf("oos: data exceeds %d parts, increase the part size", MaxPartNum))
+		}
+		part, err := bucket.UploadPart(imur, bytes.NewReader(buf[:n]), int64(n), len(parts)+1, payerOptions...)
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, part)
+		completedBytes += int64(n)
+		event = newProgressEvent(TransferDataEvent, completedBytes, 0)
+		publishProgress(listener, event)
+
+		n, err = io.ReadFull(reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+	}
+
+	// Complete the multpart upload
+	_, err = bucket.CompleteMultipartUpload(imur, parts, payerOptions...)
+	if err != nil {
+		return abort(err)
+	}
+
+	event = newProgressEvent(TransferCompletedEvent, completedBytes, 0)
+	publishProgress(listener, event)
+	return nil
+}
@@ -0,0 +1,66 @@
+package oos
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUploadStream(t *testing.T) {
+	const partSize = MinPartSize
+	tests := []struct {
+		name      string
+		size      int
+		put       int
+		partCount int
+	}{
+		{"smaller than a part", partSize - 1, 1, 0},
+		{"exactly a part", partSize, 0, 1},
+		{"one byte over a part", partSize + 1, 0, 2},
+		{"several parts", 2*partSize + 100, 0, 3},
+		{"multiple of the part size", 3 * partSize, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, server := newTestBucket(t)
+			data := bytes.Repeat([]byte("0123456789"), tt.size/10+1)[:tt.size]
+			if err := bucket.UploadStream("stream.bin", bytes.NewReader(data), partSize); err != nil {
+				t.Fatal(err)
+			}
+			if got := server.count("PutObject"); got != tt.put {
+				t.Errorf("PutObject called %d times, want %d", got, tt.put)
+			}
+			if got := server.count("UploadPart"); got != tt.partCount {
+				t.Errorf("UploadPart called %d times, want %d", got, tt.partCount)
+			}
+			if tt.partCount > 0 && server.count("CompleteMultipartUpload") != 1 {
+				t.Error("multipart upload is not completed")
+			}
+			if got := server.objects["stream.bin"]; !bytes.Equal(got, data) {
+				t.Errorf("object has %d bytes, want %d", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestUploadStreamInvalid(t *testing.T) {
+	bucket, server := newTestBucket(t)
+	tests := []struct {
+		name     string
+		key      string
+		partSize int64
+	}{
+		{"empty key", "", MinPartSize},
+		{"part size too small", "stream.bin", MinPartSize - 1},
+		{"part size too large", "stream.bin", MaxPartSize + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := bucket.UploadStream(tt.key, bytes.NewReader(nil), tt.partSize); err == nil {
+				t.Error("UploadStream() should fail")
+			}
+		})
+	}
+	if len(server.requests) != 0 {
+		t.Errorf("requests sent for invalid parameters: %v", server.requests)
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -53,21 +55,27 @@ func (bucket Object) UploadFileWithCp(objectKey, filePath string, partSize int64
 		return errors.New("oos: part size invalid range (1024KB, 5GB]")
 	}
 
+	switch getFingerprint(options) {
+	case FingerprintNone, FingerprintMD5, FingerprintSampled, FingerprintChunks, FingerprintResumedChunks:
+	default:
+		return errors.New("oos: invalid fingerprint mode")
+	}
+
 	routines := getRoutines(options)
 
-	checkpoint := getCpConfig(options)
+	store := getCheckpointStore(getCpConfig(options))
+	if store == nil {
+		return errors.New("oos: checkpoint is not configured")
+	}
 
-	return bucket.uploadFileWithCp(objectKey, filePath, partSize, options, getUploadCpFilePath(checkpoint, "", "", ""), routines)
+	return bucket.uploadFileWithCp(objectKey, filePath, partSize, options, store, getUploadCpName(filePath, bucket.BucketName, objectKey), routines)
 }
 
-func getUploadCpFilePath(cpConf *cpConfig, srcFile, destBucket, destObject string) string {
-	if cpConf.FilePath == "" && cpConf.DirPath != "" {
-		dest := fmt.Sprintf("oos://%v/%v", destBucket, destObject)
-		absPath, _ := filepath.Abs(srcFile)
-		cpFileName := getCpFileName(absPath, dest)
-		cpConf.FilePath = cpConf.DirPath + string(os.PathSeparator) + cpFileName
-	}
-	return cpConf.FilePath
+// getUploadCpName returns the checkpoint name of uploading the local file to the object
+func getUploadCpName(srcFile, destBucket, destObject string) string {
+	dest := fmt.Sprintf("oos://%v/%v", destBucket, destObject)
+	absPath, _ := filepath.Abs(srcFile)
+	return getCpFileName(absPath, dest)
 }
 
 // ----- concurrent upload without checkpoint  -----
@@ -82,6 +90,9 @@ func getCpConfig(options []Option) *cpConfig {
 	return cpcOpt.(*cpConfig)
 }
 
+// cpFileSuffix is the suffix of the checkpoint name
+const cpFileSuffix = ".cp"
+
 // getCpFileName return the name of the checkpoint file
 func getCpFileName(src, dest string) string {
 	md5Ctx := md5.New()
@@ -92,7 +103,7 @@ func getCpFileName(src, dest string) string {
 	md5Ctx.Write([]byte(dest))
 	destCheckSum := hex.EncodeToString(md5Ctx.Sum(nil))
 
-	return fmt.Sprintf("%v-%v.cp", srcCheckSum, destCheckSum)
+	return fmt.Sprintf("%v-%v%v", srcCheckSum, destCheckSum, cpFileSuffix)
 }
 
 // getRoutines gets the routine count. by default it's 1.
@@ -122,6 +133,26 @@ func getPayer(options []Option) string {
 	return payerOpt.(string)
 }
 
+// getResumeUploadID gets the upload ID to resume
+func getResumeUploadID(options []Option) string {
+	idOpt, err := findOption(options, resumeUploadID, nil)
+	if err != nil || idOpt == nil {
+		return ""
+	}
+
+	return idOpt.(string)
+}
+
+// getFingerprint gets the fingerprint mode, by default it's FingerprintSampled.
+func getFingerprint(options []Option) FingerprintMode {
+	modeOpt, err := findOption(options, fingerprintMode, nil)
+	if err != nil || modeOpt == nil {
+		return FingerprintSampled
+	}
+
+	return modeOpt.(FingerprintMode)
+}
+
 // getProgressListener gets the progress callback
 func getProgressListener(options []Option) ProgressListener {
 	isSet, listener, _ := isOptionSet(options, progressListener)
@@ -265,26 +296,31 @@ func (bucket Object) uploadFile(objectKey, filePath string, partSize int64, opti
 // ----- concurrent upload with checkpoint  -----
 const uploadCpMagic = "FE8BB4EA-B593-4FAC-AD7A-2459A36E2E62"
 
+// fingerprintSampleSize is the block size of FingerprintSampled
+const fingerprintSampleSize = 1024 * 1024
+
 type uploadCheckpoint struct {
-	Magic     string   // Magic
-	MD5       string   // Checkpoint file content's MD5
-	FilePath  string   // Local file path
-	FileStat  cpStat   // File state
-	ObjectKey string   // Key
-	UploadID  string   // Upload ID
-	Parts     []cpPart // All parts of the local file
+	Magic     string          // Magic
+	MD5       string          // Checkpoint file content's MD5
+	FilePath  string          // Local file path
+	FileStat  cpStat          // File state
+	Mode      FingerprintMode // Fingerprint mode of the local file
+	ObjectKey string          // Key
+	UploadID  string          // Upload ID
+	Parts     []cpPart        // All parts of the local file
 }
 
 type cpStat struct {
 	Size         int64     // File size
 	LastModified time.Time // File's last modified time
-	MD5          string    // Local file's MD5
+	MD5          string    // Local file's fingerprint, only for FingerprintMD5 and FingerprintSampled
 }
 
 type cpPart struct {
 	Chunk       FileChunk  // File chunk
 	Part        UploadPart // Uploaded part
 	IsCompleted bool       // Upload complete flag
+	MD5         string     // Chunk's MD5, only for FingerprintChunks and FingerprintResumedChunks
 }
 
 // isValid checks if the uploaded data is valid---it's valid when the file is not updated and the checkpoint data is valid.
@@ -312,24 +348,67 @@ func (cp uploadCheckpoint) isValid(filePath string) (bool, error) {
 		return false, err
 	}
 
-	md, err := calcFileMD5(filePath)
-	if err != nil {
-		return false, err
-	}
-
-	// Compare the file size, file's last modified time and file's MD5
+	// Compare the file size and file's last modified time
 	if cp.FileStat.Size != st.Size() ||
-		cp.FileStat.LastModified != st.ModTime() ||
-		cp.FileStat.MD5 != md {
+		!cp.FileStat.LastModified.Equal(st.ModTime()) {
 		return false, nil
 	}
 
+	// Compare the fingerprint in the mode the CP is created with, the CP without mode is created in FingerprintNone.
+	// The uploaded chunks of FingerprintResumedChunks are rehashed by rehashCompleted.
+	switch cp.Mode {
+	case FingerprintMD5, FingerprintSampled:
+		md, err := calcFileFingerprint(filePath, cp.Mode)
+		if err != nil {
+			return false, err
+		}
+		return cp.FileStat.MD5 == md, nil
+	case FingerprintChunks:
+		for _, part := range cp.Parts {
+			md, err := calcChunkMD5(fd, part.Chunk)
+			if err != nil {
+				return false, err
+			}
+			if part.MD5 != md {
+				return false, nil
+			}
+		}
+	}
+
 	return true, nil
 }
 
-// load loads from the file
-func (cp *uploadCheckpoint) load(filePath string) error {
-	contents, err := ioutil.ReadFile(filePath)
+// rehashCompleted rehashes the completed chunks of FingerprintResumedChunks, the changed chunks are marked incomplete
+func (cp *uploadCheckpoint) rehashCompleted(filePath string) error {
+	if cp.Mode != FingerprintResumedChunks {
+		return nil
+	}
+
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	for i, part := range cp.Parts {
+		if !part.IsCompleted {
+			continue
+		}
+		md, err := calcChunkMD5(fd, part.Chunk)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(part.MD5, md) {
+			cp.Parts[i].Part = UploadPart{}
+			cp.Parts[i].IsCompleted = false
+		}
+	}
+	return nil
+}
+
+// load loads from the checkpoint store
+func (cp *uploadCheckpoint) load(store CheckpointStore, name string) error {
+	contents, err := store.Load(name)
 	if err != nil {
 		return err
 	}
@@ -338,8 +417,8 @@ func (cp *uploadCheckpoint) load(filePath string) error {
 	return err
 }
 
-// dump dumps to the local file
-func (cp *uploadCheckpoint) dump(filePath string) error {
+// dump dumps to the checkpoint store
+func (cp *uploadCheckpoint) dump(store CheckpointStore, name string) error {
 	bcp := *cp
 
 	// Calculate MD5
@@ -359,7 +438,7 @@ func (cp *uploadCheckpoint) dump(filePath string) error {
 	}
 
 	// Dump
-	return ioutil.WriteFile(filePath, js, FilePermMode)
+	return store.Save(name, js)
 }
 
 // updatePart updates the part status
@@ -399,17 +478,81 @@ func (cp *uploadCheckpoint) getCompletedBytes() int64 {
 	return completedBytes
 }
 
+// calcFileFingerprint calculates the fingerprint of the local file, it's empty if the mode doesn't fingerprint the whole file
+func calcFileFingerprint(filePath string, mode FingerprintMode) (string, error) {
+	switch mode {
+	case FingerprintMD5:
+		return calcFileMD5(filePath)
+	case FingerprintSampled:
+		return calcSampledMD5(filePath)
+	}
+	return "", nil
+}
+
 // calcFileMD5 calculates the MD5 for the specified local file
 func calcFileMD5(filePath string) (string, error) {
-	return "", nil
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	h := md5.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// calcSampledMD5 calculates the MD5 of the head, middle and tail blocks, the small file is hashed entirely
+func calcSampledMD5(filePath string) (string, error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	st, err := fd.Stat()
+	if err != nil {
+		return "", err
+	}
+	size := st.Size()
+	if size <= 3*fingerprintSampleSize {
+		return calcFileMD5(filePath)
+	}
+
+	h := md5.New()
+	for _, offset := range []int64{0, (size - fingerprintSampleSize) / 2, size - fingerprintSampleSize} {
+		if _, err = io.Copy(h, io.NewSectionReader(fd, offset, fingerprintSampleSize)); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // prepare initializes the multipart upload
 func prepare(cp *uploadCheckpoint, objectKey, filePath string, partSize int64, bucket *Object, options []Option) error {
+	if err := initCheckpoint(cp, objectKey, filePath, partSize, getFingerprint(options)); err != nil {
+		return err
+	}
+
+	// Init load
+	imur, err := bucket.InitiateMultipartUpload(objectKey, options...)
+	if err != nil {
+		return err
+	}
+	cp.UploadID = imur.UploadID
+
+	return nil
+}
+
+// initCheckpoint initializes the checkpoint with the local file state and chunks, all chunks are not completed
+func initCheckpoint(cp *uploadCheckpoint, objectKey, filePath string, partSize int64, mode FingerprintMode) error {
 	// CP
 	cp.Magic = uploadCpMagic
 	cp.FilePath = filePath
 	cp.ObjectKey = objectKey
+	cp.Mode = mode
 
 	// Local file
 	fd, err := os.Open(filePath)
@@ -424,7 +567,7 @@ func prepare(cp *uploadCheckpoint, objectKey, filePath string, partSize int64, b
 	}
 	cp.FileStat.Size = st.Size()
 	cp.FileStat.LastModified = st.ModTime()
-	md, err := calcFileMD5(filePath)
+	md, err := calcFileFingerprint(filePath, mode)
 	if err != nil {
 		return err
 	}
@@ -440,32 +583,154 @@ func prepare(cp *uploadCheckpoint, objectKey, filePath string, partSize int64, b
 	for i, part := range parts {
 		cp.Parts[i].Chunk = part
 		cp.Parts[i].IsCompleted = false
+		if mode == FingerprintChunks {
+			if cp.Parts[i].MD5, err = calcChunkMD5(fd, part); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Init load
-	imur, err := bucket.InitiateMultipartUpload(objectKey, options...)
+	return nil
+}
+
+// rebuild rebuilds the checkpoint from the parts already uploaded with the upload ID. A part is completed
+// only if its ETag equals the MD5 of the matching local chunk, the missing or mismatched parts are uploaded again.
+func rebuild(cp *uploadCheckpoint, objectKey, filePath string, partSize int64, bucket *Object, uploadID string, mode FingerprintMode) error {
+	imur := InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: objectKey, UploadID: uploadID}
+	parts, err := listAllUploadedParts(bucket, imur)
 	if err != nil {
 		return err
 	}
-	cp.UploadID = imur.UploadID
 
+	// Split the file by the part size of the upload so that the chunks match the uploaded parts
+	if size := uploadedPartSize(parts); size > 0 {
+		partSize = size
+	}
+	if err = initCheckpoint(cp, objectKey, filePath, partSize, mode); err != nil {
+		return err
+	}
+	cp.UploadID = uploadID
+
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	for _, part := range parts {
+		if part.PartNumber < 1 || part.PartNumber > len(cp.Parts) {
+			continue
+		}
+		chunk := cp.Parts[part.PartNumber-1].Chunk
+		if int64(part.Size) != chunk.Size {
+			continue
+		}
+		md, err := calcChunkMD5(fd, chunk)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(strings.Trim(part.ETag, "\""), md) {
+			cp.updatePart(UploadPart{PartNumber: part.PartNumber, ETag: part.ETag})
+			cp.Parts[part.PartNumber-1].MD5 = md
+		}
+	}
+	return nil
+}
+
+// reconcile validates the CP data with the parts uploaded on the server. The completed parts missing on the server
+// or with a different ETag are marked incomplete, and a new upload is initiated if the upload ID no longer exists.
+func reconcile(cp *uploadCheckpoint, objectKey string, bucket *Object, options []Option) error {
+	imur := InitiateMultipartUploadResult{Bucket: bucket.BucketName, Key: objectKey, UploadID: cp.UploadID}
+	parts, err := listAllUploadedParts(bucket, imur)
+	if err != nil {
+		if e, ok := err.(ServiceError); !ok || e.Code != "NoSuchUpload" {
+			return err
+		}
+		imur, err = bucket.InitiateMultipartUpload(objectKey, options...)
+		if err != nil {
+			return err
+		}
+		cp.ObjectKey = objectKey
+		cp.UploadID = imur.UploadID
+		parts = nil
+	}
+
+	uploaded := map[int]string{}
+	for _, part := range parts {
+		uploaded[part.PartNumber] = strings.Trim(part.ETag, "\"")
+	}
+	for i, part := range cp.Parts {
+		if !part.IsCompleted {
+			continue
+		}
+		etag, ok := uploaded[part.Part.PartNumber]
+		if !ok || !strings.EqualFold(etag, strings.Trim(part.Part.ETag, "\"")) {
+			cp.Parts[i].Part = UploadPart{}
+			cp.Parts[i].IsCompleted = false
+		}
+	}
 	return nil
 }
 
-// complete completes the multipart upload and deletes the local CP files
-func complete(cp *uploadCheckpoint, bucket *Object, parts []UploadPart, cpFilePath string, options []Option) error {
+// listAllUploadedParts lists all the uploaded parts of the upload, following PartNumberMarker
+func listAllUploadedParts(bucket *Object, imur InitiateMultipartUploadResult) ([]UploadedPart, error) {
+	parts := []UploadedPart{}
+	marker := 0
+	for {
+		lupr, err := bucket.ListUploadedParts(imur, MaxParts(1000), PartNumberMarker(marker))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, lupr.UploadedParts...)
+		if !lupr.IsTruncated || len(lupr.UploadedParts) == 0 {
+			break
+		}
+		next, err := strconv.Atoi(lupr.NextPartNumberMarker)
+		if err != nil || next <= marker {
+			next = lupr.UploadedParts[len(lupr.UploadedParts)-1].PartNumber
+		}
+		marker = next
+	}
+	return parts, nil
+}
+
+// uploadedPartSize returns the part size of the upload, it's the size of part 1 or the largest part if part 1 is missing
+func uploadedPartSize(parts []UploadedPart) int64 {
+	var size int64
+	for _, part := range parts {
+		if part.PartNumber == 1 {
+			return int64(part.Size)
+		}
+		if int64(part.Size) > size {
+			size = int64(part.Size)
+		}
+	}
+	return size
+}
+
+// calcChunkMD5 calculates the hex MD5 of the chunk in the local file
+func calcChunkMD5(fd *os.File, chunk FileChunk) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(fd, chunk.Offset, chunk.Size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// complete completes the multipart upload and deletes the CP data
+func complete(cp *uploadCheckpoint, bucket *Object, parts []UploadPart, store CheckpointStore, cpName string, options []Option) error {
 	imur := InitiateMultipartUploadResult{Bucket: bucket.BucketName,
 		Key: cp.ObjectKey, UploadID: cp.UploadID}
 	_, err := bucket.CompleteMultipartUpload(imur, parts, options...)
 	if err != nil {
 		return err
 	}
-	os.Remove(cpFilePath)
+	store.Delete(cpName)
 	return err
 }
 
 // uploadFileWithCp handles concurrent upload with checkpoint
-func (bucket Object) uploadFileWithCp(objectKey, filePath string, partSize int64, options []Option, cpFilePath string, routines int) error {
+func (bucket Object) uploadFileWithCp(objectKey, filePath string, partSize int64, options []Option, store CheckpointStore, cpName string, routines int) error {
 	listener := getProgressListener(options)
 
 	payerOptions := []Option{}
@@ -476,18 +741,35 @@ func (bucket Object) uploadFileWithCp(objectKey, filePath string, partSize int64
 
 	// Load CP data
 	ucp := uploadCheckpoint{}
-	err := ucp.load(cpFilePath)
+	err := ucp.load(store, cpName)
 	if err != nil {
-		os.Remove(cpFilePath)
+		store.Delete(cpName)
 	}
 
-	// Load error or the CP data is invalid.
-	valid, err := ucp.isValid(filePath)
-	if err != nil || !valid {
-		if err = prepare(&ucp, objectKey, filePath, partSize, &bucket, options); err != nil {
+	if uploadID := getResumeUploadID(options); uploadID != "" {
+		// Rebuild the CP data from the server, the local CP data may be missing or belong to another upload.
+		if err = rebuild(&ucp, objectKey, filePath, partSize, &bucket, uploadID, getFingerprint(options)); err != nil {
 			return err
 		}
-		os.Remove(cpFilePath)
+		ucp.dump(store, cpName)
+	} else {
+		// Load error or the CP data is invalid.
+		valid, err := ucp.isValid(filePath)
+		if err != nil || !valid {
+			if err = prepare(&ucp, objectKey, filePath, partSize, &bucket, options); err != nil {
+				return err
+			}
+			store.Delete(cpName)
+		} else {
+			if err = ucp.rehashCompleted(filePath); err != nil {
+				return err
+			}
+			// The upload may be aborted or purged on the server since the CP data was dumped.
+			if err = reconcile(&ucp, objectKey, &bucket, options); err != nil {
+				return err
+			}
+			ucp.dump(store, cpName)
+		}
 	}
 
 	chunks := ucp.todoParts()
@@ -521,7 +803,11 @@ func (bucket Object) uploadFileWithCp(objectKey, filePath string, partSize int64
 		case part := <-results:
 			completed++
 			ucp.updatePart(part)
-			ucp.dump(cpFilePath)
+			if ucp.Mode == FingerprintResumedChunks {
+				// The part's ETag is the MD5 of the uploaded data, the file may be changed after the upload
+				ucp.Parts[part.PartNumber-1].MD5 = strings.ToLower(strings.Trim(part.ETag, "\""))
+			}
+			ucp.dump(store, cpName)
 			completedBytes += ucp.Parts[part.PartNumber-1].Chunk.Size
 			event = newProgressEvent(TransferDataEvent, completedBytes, ucp.FileStat.Size)
 			publishProgress(listener, event)
@@ -541,6 +827,6 @@ func (bucket Object) uploadFileWithCp(objectKey, filePath string, partSize int64
 	publishProgress(listener, event)
 
 	// Complete the multipart upload
-	err = complete(&ucp, &bucket, ucp.allParts(), cpFilePath, payerOptions)
+	err = complete(&ucp, &bucket, ucp.allParts(), store, cpName, payerOptions)
 	return err
 }
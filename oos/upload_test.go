@@ -0,0 +1,384 @@
+package oos
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPartSize = 1024
+
+// writeTestFile writes size bytes to a file in the temporary directory, every chunk of testPartSize has different content
+func writeTestFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i/testPartSize + i%7)
+	}
+	filePath := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath, data
+}
+
+// completedParts returns the part numbers of the completed parts
+func completedParts(cp *uploadCheckpoint) []int {
+	parts := []int{}
+	for _, part := range cp.Parts {
+		if part.IsCompleted {
+			parts = append(parts, part.Chunk.Number)
+		}
+	}
+	return parts
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRebuild(t *testing.T) {
+	filePath, data := writeTestFile(t, 3*testPartSize+100)
+	chunk := func(n int) []byte {
+		end := n * testPartSize
+		if end > len(data) {
+			end = len(data)
+		}
+		return data[(n-1)*testPartSize : end]
+	}
+	tests := []struct {
+		name      string
+		uploaded  map[int][]byte
+		partSize  int64
+		chunks    int
+		completed []int
+	}{
+		{"no part uploaded", nil, testPartSize, 4, []int{}},
+		{"all parts uploaded", map[int][]byte{1: chunk(1), 2: chunk(2), 3: chunk(3), 4: chunk(4)}, testPartSize, 4, []int{1, 2, 3, 4}},
+		{"missing part", map[int][]byte{1: chunk(1), 3: chunk(3)}, testPartSize, 4, []int{1, 3}},
+		{"changed part", map[int][]byte{1: chunk(1), 2: chunk(3)}, testPartSize, 4, []int{1}},
+		{"part of another size", map[int][]byte{1: chunk(1), 4: chunk(4)[:50]}, testPartSize, 4, []int{1}},
+		{"part beyond the file", map[int][]byte{1: chunk(1), 5: chunk(1)}, testPartSize, 4, []int{1}},
+		{"part size of the upload", map[int][]byte{1: chunk(1), 2: chunk(2)}, 2 * testPartSize, 4, []int{1, 2}},
+		{"largest part without part 1", map[int][]byte{2: chunk(2), 3: chunk(3)[:10]}, 2 * testPartSize, 4, []int{2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, server := newTestBucket(t)
+			uploadID := server.initiate(tt.uploaded)
+			cp := uploadCheckpoint{}
+			if err := rebuild(&cp, "file.bin", filePath, tt.partSize, bucket, uploadID, FingerprintNone); err != nil {
+				t.Fatal(err)
+			}
+			if cp.UploadID != uploadID || cp.ObjectKey != "file.bin" {
+				t.Errorf("checkpoint upload = %s %s, want %s file.bin", cp.UploadID, cp.ObjectKey, uploadID)
+			}
+			if len(cp.Parts) != tt.chunks {
+				t.Fatalf("checkpoint has %d chunks, want %d", len(cp.Parts), tt.chunks)
+			}
+			if got := completedParts(&cp); !equalInts(got, tt.completed) {
+				t.Errorf("completed parts = %v, want %v", got, tt.completed)
+			}
+			for _, part := range cp.Parts {
+				if part.IsCompleted && part.MD5 != hexMD5(chunk(part.Chunk.Number)) {
+					t.Errorf("part %d MD5 = %s, want the chunk MD5", part.Chunk.Number, part.MD5)
+				}
+			}
+		})
+	}
+}
+
+func TestRebuildNoSuchUpload(t *testing.T) {
+	filePath, _ := writeTestFile(t, testPartSize)
+	bucket, _ := newTestBucket(t)
+	cp := uploadCheckpoint{}
+	err := rebuild(&cp, "file.bin", filePath, testPartSize, bucket, "missing", FingerprintNone)
+	if e, ok := err.(ServiceError); !ok || e.Code != "NoSuchUpload" {
+		t.Errorf("rebuild() = %v, want NoSuchUpload", err)
+	}
+}
+
+func TestUploadFileResumeUploadID(t *testing.T) {
+	filePath, data := writeTestFile(t, 2*MinPartSize+100)
+	bucket, server := newTestBucket(t)
+	uploadID := server.initiate(map[int][]byte{1: data[:MinPartSize]})
+	cpFile := filepath.Join(t.TempDir(), "file.cp")
+	err := bucket.UploadFileWithCp("file.bin", filePath, MinPartSize, Checkpoint(true, cpFile), ResumeUploadID(uploadID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := server.count("UploadPart"); got != 2 {
+		t.Errorf("UploadPart called %d times, want 2", got)
+	}
+	if got := server.count("InitiateMultipartUpload"); got != 0 {
+		t.Errorf("InitiateMultipartUpload called %d times, want 0", got)
+	}
+	if !bytes.Equal(server.objects["file.bin"], data) {
+		t.Error("object content differs from the file")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	filePath, data := writeTestFile(t, 3*testPartSize)
+	chunk := func(n int) []byte {
+		return data[(n-1)*testPartSize : n*testPartSize]
+	}
+	etag := func(n int) string {
+		return `"` + hexMD5(chunk(n)) + `"`
+	}
+	tests := []struct {
+		name      string
+		uploaded  map[int][]byte
+		completed map[int]string
+		want      []int
+	}{
+		{"all parts on the server", map[int][]byte{1: chunk(1), 2: chunk(2)}, map[int]string{1: etag(1), 2: etag(2)}, []int{1, 2}},
+		{"etag is case insensitive", map[int][]byte{1: chunk(1)}, map[int]string{1: strings.ToUpper(etag(1))}, []int{1}},
+		{"part missing on the server", map[int][]byte{1: chunk(1)}, map[int]string{1: etag(1), 2: etag(2)}, []int{1}},
+		{"part with another etag", map[int][]byte{1: chunk(1), 2: chunk(3)}, map[int]string{1: etag(1), 2: etag(2)}, []int{1}},
+		{"incomplete part uploaded", map[int][]byte{1: chunk(1), 3: chunk(3)}, map[int]string{1: etag(1)}, []int{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, server := newTestBucket(t)
+			cp := uploadCheckpoint{}
+			if err := initCheckpoint(&cp, "file.bin", filePath, testPartSize, FingerprintNone); err != nil {
+				t.Fatal(err)
+			}
+			cp.UploadID = server.initiate(tt.uploaded)
+			for n, etag := range tt.completed {
+				cp.updatePart(UploadPart{PartNumber: n, ETag: etag})
+			}
+			uploadID := cp.UploadID
+			if err := reconcile(&cp, "file.bin", bucket, nil); err != nil {
+				t.Fatal(err)
+			}
+			if cp.UploadID != uploadID {
+				t.Errorf("upload ID = %s, want %s", cp.UploadID, uploadID)
+			}
+			if got := completedParts(&cp); !equalInts(got, tt.want) {
+				t.Errorf("completed parts = %v, want %v", got, tt.want)
+			}
+			for _, part := range cp.Parts {
+				if !part.IsCompleted && part.Part.ETag != "" {
+					t.Errorf("incomplete part %d keeps ETag %s", part.Chunk.Number, part.Part.ETag)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileNoSuchUpload(t *testing.T) {
+	filePath, _ := writeTestFile(t, 3*testPartSize)
+	bucket, server := newTestBucket(t)
+	cp := uploadCheckpoint{}
+	if err := initCheckpoint(&cp, "old.bin", filePath, testPartSize, FingerprintNone); err != nil {
+		t.Fatal(err)
+	}
+	cp.UploadID = "aborted"
+	cp.updatePart(UploadPart{PartNumber: 1, ETag: `"etag"`})
+	cp.updatePart(UploadPart{PartNumber: 2, ETag: `"etag"`})
+
+	if err := reconcile(&cp, "file.bin", bucket, nil); err != nil {
+		t.Fatal(err)
+	}
+	if server.count("InitiateMultipartUpload") != 1 || server.uploads[cp.UploadID] == nil {
+		t.Fatalf("upload ID = %s, want a new upload", cp.UploadID)
+	}
+	if cp.ObjectKey != "file.bin" {
+		t.Errorf("object key = %s, want file.bin", cp.ObjectKey)
+	}
+	if got := completedParts(&cp); len(got) != 0 {
+		t.Errorf("completed parts = %v, want none", got)
+	}
+}
+
+func TestUploadFileWithCpNoSuchUpload(t *testing.T) {
+	filePath, data := writeTestFile(t, 2*MinPartSize+100)
+	bucket, server := newTestBucket(t)
+	cpFile := filepath.Join(t.TempDir(), "file.cp")
+
+	// The checkpoint refers to an upload aborted on the server
+	cp := uploadCheckpoint{}
+	if err := initCheckpoint(&cp, "file.bin", filePath, MinPartSize, FingerprintSampled); err != nil {
+		t.Fatal(err)
+	}
+	cp.UploadID = "aborted"
+	cp.updatePart(UploadPart{PartNumber: 1, ETag: `"` + hexMD5(data[:MinPartSize]) + `"`})
+	if err := cp.dump(FileCheckpointStore(cpFile), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := bucket.UploadFileWithCp("file.bin", filePath, MinPartSize, Checkpoint(true, cpFile)); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.count("UploadPart"); got != 3 {
+		t.Errorf("UploadPart called %d times, want 3", got)
+	}
+	if !bytes.Equal(server.objects["file.bin"], data) {
+		t.Error("object content differs from the file")
+	}
+	if _, err := os.Stat(cpFile); !os.IsNotExist(err) {
+		t.Errorf("checkpoint file is not deleted: %v", err)
+	}
+}
+
+// modifyTestFile changes the byte at the offset, the file size and last modified time are kept
+func modifyTestFile(t *testing.T, filePath string, offset int64) {
+	t.Helper()
+	st, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err = fd.ReadAt(b, offset); err == nil {
+		b[0]++
+		_, err = fd.WriteAt(b, offset)
+	}
+	fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(filePath, st.ModTime(), st.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCalcSampledMD5(t *testing.T) {
+	const size = 4 * fingerprintSampleSize
+	tests := []struct {
+		name    string
+		size    int
+		offset  int64
+		changed bool
+	}{
+		{"small file head", 3 * fingerprintSampleSize, 0, true},
+		{"small file middle", 3 * fingerprintSampleSize, fingerprintSampleSize + 10, true},
+		{"head", size, 0, true},
+		{"end of head", size, fingerprintSampleSize - 1, true},
+		{"between head and middle", size, fingerprintSampleSize + 10, false},
+		{"middle", size, 2 * fingerprintSampleSize, true},
+		{"between middle and tail", size, 3*fingerprintSampleSize - 10, false},
+		{"tail", size, size - 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath, data := writeTestFile(t, tt.size)
+			before, err := calcSampledMD5(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.size <= 3*fingerprintSampleSize && before != hexMD5(data) {
+				t.Errorf("calcSampledMD5() = %s, want the MD5 of the whole file", before)
+			}
+			modifyTestFile(t, filePath, tt.offset)
+			after, err := calcSampledMD5(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (before != after) != tt.changed {
+				t.Errorf("fingerprint changed = %v, want %v", before != after, tt.changed)
+			}
+		})
+	}
+}
+
+func TestCheckpointFingerprint(t *testing.T) {
+	const size = 4 * fingerprintSampleSize
+	tests := []struct {
+		mode   FingerprintMode
+		offset int64
+		valid  bool
+	}{
+		{FingerprintNone, 0, true},
+		{FingerprintMD5, fingerprintSampleSize + 10, false},
+		{FingerprintSampled, 0, false},
+		{FingerprintSampled, fingerprintSampleSize + 10, true},
+		{FingerprintChunks, fingerprintSampleSize + 10, false},
+		{FingerprintResumedChunks, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s at %d", tt.mode, tt.offset), func(t *testing.T) {
+			filePath, _ := writeTestFile(t, size)
+			cp := uploadCheckpoint{}
+			if err := initCheckpoint(&cp, "file.bin", filePath, fingerprintSampleSize, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			cp.Magic = uploadCpMagic
+			data, err := json.Marshal(cp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := md5.Sum(data)
+			cp.MD5 = base64.StdEncoding.EncodeToString(sum[:])
+			if valid, err := cp.isValid(filePath); err != nil || !valid {
+				t.Fatalf("isValid() = %v, %v before the file is changed", valid, err)
+			}
+
+			modifyTestFile(t, filePath, tt.offset)
+			valid, err := cp.isValid(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if valid != tt.valid {
+				t.Errorf("isValid() = %v, want %v", valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestRehashCompleted(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      FingerprintMode
+		offset    int64
+		completed []int
+	}{
+		{"unchanged", FingerprintResumedChunks, -1, []int{1, 2}},
+		{"completed chunk changed", FingerprintResumedChunks, testPartSize + 1, []int{1}},
+		{"incomplete chunk changed", FingerprintResumedChunks, 2 * testPartSize, []int{1, 2}},
+		{"other mode", FingerprintNone, testPartSize + 1, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath, data := writeTestFile(t, 3*testPartSize)
+			cp := uploadCheckpoint{}
+			if err := initCheckpoint(&cp, "file.bin", filePath, testPartSize, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range []int{1, 2} {
+				md := hexMD5(data[(n-1)*testPartSize : n*testPartSize])
+				cp.updatePart(UploadPart{PartNumber: n, ETag: `"` + md + `"`})
+				// The MD5 is taken from the ETag in upper case by some servers
+				cp.Parts[n-1].MD5 = strings.ToUpper(md)
+			}
+			if tt.offset >= 0 {
+				modifyTestFile(t, filePath, tt.offset)
+			}
+			if err := cp.rehashCompleted(filePath); err != nil {
+				t.Fatal(err)
+			}
+			if got := completedParts(&cp); !equalInts(got, tt.completed) {
+				t.Errorf("completed parts = %v, want %v", got, tt.completed)
+			}
+		})
+	}
+}
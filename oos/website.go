@@ -0,0 +1,225 @@
+package oos
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrWebsiteObjectNotFound is returned by WebsiteSource.Open if the object doesn't exist
+var ErrWebsiteObjectNotFound = errors.New("oos: website object not found")
+
+// WebsiteSource provides the objects of a static website
+type WebsiteSource interface {
+	// Open returns the object content and headers such as Content-Type and Content-Length.
+	// It returns ErrWebsiteObjectNotFound if the object doesn't exist.
+	Open(key string) (io.ReadCloser, http.Header, error)
+}
+
+// DirWebsiteSource serves the objects from a local directory, the object key is the relative path
+type DirWebsiteSource string
+
+// Open implements WebsiteSource
+func (d DirWebsiteSource) Open(key string) (io.ReadCloser, http.Header, error) {
+	name := filepath.Join(string(d), filepath.FromSlash(path.Clean("/"+key)))
+	fd, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrWebsiteObjectNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, nil, err
+	}
+	if fi.IsDir() {
+		fd.Close()
+		return nil, nil, ErrWebsiteObjectNotFound
+	}
+	header := http.Header{}
+	header.Set(HTTPHeaderContentType, TypeByExtension(name))
+	header.Set(HTTPHeaderContentLength, strconv.FormatInt(fi.Size(), 10))
+	header.Set(HTTPHeaderLastModified, fi.ModTime().UTC().Format(http.TimeFormat))
+	return fd, header, nil
+}
+
+// BucketWebsiteSource serves the objects under the prefix of a bucket
+type BucketWebsiteSource struct {
+	Bucket *Object
+	Prefix string
+}
+
+// Open implements WebsiteSource
+func (s BucketWebsiteSource) Open(key string) (io.ReadCloser, http.Header, error) {
+	result, err := s.Bucket.DoGetObject(&GetObjectRequest{s.Prefix + key}, nil)
+	if err != nil {
+		if e, ok := err.(ServiceError); ok && e.StatusCode == http.StatusNotFound {
+			return nil, nil, ErrWebsiteObjectNotFound
+		}
+		return nil, nil, err
+	}
+	return result.Response.Body, result.Response.Headers, nil
+}
+
+// websiteHeaders are the object headers returned to the client
+var websiteHeaders = []string{
+	HTTPHeaderContentType, HTTPHeaderContentLength, HTTPHeaderContentEncoding, HTTPHeaderContentDisposition,
+	HTTPHeaderCacheControl, HTTPHeaderLastModified, HTTPHeaderEtag, HTTPHeaderExpires,
+}
+
+type websiteHandler struct {
+	config WebsiteConfiguration
+	source WebsiteSource
+}
+
+// NewWebsiteHandler creates an http.Handler serving the objects as a bucket static website does.
+//
+// It applies RedirectAllRequestsTo, the routing rules, IndexDocument and ErrorDocument. Routing rules without
+// HttpErrorCodeReturnedEquals are applied before reading the object, the others after the object is not found.
+//
+// config    the website configuration, such as the one passed to SetBucketWebsite.
+// source    the source of the objects.
+//
+// http.Handler    the handler serving GET and HEAD requests.
+func NewWebsiteHandler(config WebsiteConfiguration, source WebsiteSource) http.Handler {
+	return &websiteHandler{config: config, source: source}
+}
+
+// ServeHTTP implements http.Handler
+func (h *websiteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if all := h.config.WebsiteAllRequestTo; all != nil && all.HostName != "" {
+		http.Redirect(w, r, websiteURL(r, all.Protocol, all.HostName, r.URL.Path), http.StatusMovedPermanently)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	if rule := h.routingRule(key, 0); rule != nil {
+		http.Redirect(w, r, redirectURL(r, rule, key), http.StatusMovedPermanently)
+		return
+	}
+
+	index := h.config.IndexDocument.Suffix
+	body, header, err := h.open(key, index)
+	if err == nil {
+		serveWebsiteObject(w, r, http.StatusOK, body, header)
+		return
+	}
+	if err != ErrWebsiteObjectNotFound {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A folder requested without the trailing slash is redirected to its index document
+	if key != "" && !strings.HasSuffix(key, "/") && index != "" {
+		if body, _, err := h.source.Open(key + "/" + index); err == nil {
+			body.Close()
+			http.Redirect(w, r, "/"+key+"/", http.StatusFound)
+			return
+		}
+	}
+	if rule := h.routingRule(key, http.StatusNotFound); rule != nil {
+		http.Redirect(w, r, redirectURL(r, rule, key), http.StatusMovedPermanently)
+		return
+	}
+	if doc := h.config.ErrorDocument.Key; doc != "" {
+		if body, header, err := h.source.Open(doc); err == nil {
+			serveWebsiteObject(w, r, http.StatusNotFound, body, header)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// open opens the object, or the index document if the key is a folder
+func (h *websiteHandler) open(key, index string) (io.ReadCloser, http.Header, error) {
+	if key == "" || strings.HasSuffix(key, "/") {
+		if index == "" {
+			return nil, nil, ErrWebsiteObjectNotFound
+		}
+		key += index
+	}
+	return h.source.Open(key)
+}
+
+// routingRule returns the first rule matching the key, code is the error code returned, 0 if the object isn't read yet
+func (h *websiteHandler) routingRule(key string, code int) *RoutingRule {
+	for i := range h.config.RoutingRules {
+		rule := &h.config.RoutingRules[i]
+		if rule.Redirect == nil {
+			continue
+		}
+		cond := rule.Condition
+		if cond == nil {
+			if code == 0 {
+				return rule
+			}
+			continue
+		}
+		if cond.HttpErrorCodeReturnedEquals != "" && cond.HttpErrorCodeReturnedEquals != strconv.Itoa(code) {
+			continue
+		}
+		if cond.HttpErrorCodeReturnedEquals == "" && code != 0 {
+			continue
+		}
+		if strings.HasPrefix(key, cond.KeyPrefixEquals) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func redirectURL(r *http.Request, rule *RoutingRule, key string) string {
+	redirect := rule.Redirect
+	switch {
+	case redirect.ReplaceKeyWith != "":
+		key = redirect.ReplaceKeyWith
+	case redirect.ReplaceKeyPrefixWith != "":
+		prefix := ""
+		if rule.Condition != nil {
+			prefix = rule.Condition.KeyPrefixEquals
+		}
+		key = redirect.ReplaceKeyPrefixWith + strings.TrimPrefix(key, prefix)
+	}
+	return websiteURL(r, redirect.Protocol, redirect.HostName, "/"+key)
+}
+
+// websiteURL builds the redirect URL, the protocol and host of the request are used if they are empty
+func websiteURL(r *http.Request, protocol, host, p string) string {
+	if protocol == "" {
+		protocol = "http"
+		if r.TLS != nil {
+			protocol = "https"
+		}
+	}
+	if host == "" {
+		host = r.Host
+	}
+	u := url.URL{Scheme: protocol, Host: host, Path: p}
+	return u.String()
+}
+
+func serveWebsiteObject(w http.ResponseWriter, r *http.Request, code int, body io.ReadCloser, header http.Header) {
+	defer body.Close()
+	for _, k := range websiteHeaders {
+		if v := header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		io.Copy(w, body)
+	}
+}
@@ -0,0 +1,192 @@
+package oos
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mapWebsiteSource serves the objects from a map of key to content
+type mapWebsiteSource map[string]string
+
+func (m mapWebsiteSource) Open(key string) (io.ReadCloser, http.Header, error) {
+	content, ok := m[key]
+	if !ok {
+		return nil, nil, ErrWebsiteObjectNotFound
+	}
+	header := http.Header{}
+	header.Set(HTTPHeaderContentType, TypeByExtension(key))
+	return io.NopCloser(strings.NewReader(content)), header, nil
+}
+
+var testWebsiteObjects = mapWebsiteSource{
+	"index.html":       "home",
+	"about/index.html": "about",
+	"docs/a.html":      "docs a",
+	"images/logo.png":  "logo",
+	"error.html":       "error page",
+}
+
+func prefixRule(prefix string, redirect Redirect) RoutingRule {
+	return RoutingRule{Condition: &Condition{KeyPrefixEquals: prefix}, Redirect: &redirect}
+}
+
+func errorCodeRule(code, prefix string, redirect Redirect) RoutingRule {
+	return RoutingRule{Condition: &Condition{HttpErrorCodeReturnedEquals: code, KeyPrefixEquals: prefix}, Redirect: &redirect}
+}
+
+type websiteCase struct {
+	name     string
+	method   string
+	path     string
+	code     int
+	location string
+	body     string
+}
+
+func testWebsiteHandler(t *testing.T, config WebsiteConfiguration, tests []websiteCase) {
+	t.Helper()
+	handler := NewWebsiteHandler(config, testWebsiteObjects)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(method, "http://example.com"+tt.path, nil))
+			if w.Code != tt.code {
+				t.Fatalf("%s %s = %d, want %d", method, tt.path, w.Code, tt.code)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestWebsiteHandlerRoutingRules(t *testing.T) {
+	config := WebsiteConfiguration{
+		IndexDocument: IndexDocument{Suffix: "index.html"},
+		ErrorDocument: ErrorDocument{Key: "error.html"},
+		RoutingRules: []RoutingRule{
+			{Condition: &Condition{KeyPrefixEquals: "ignored/"}},
+			prefixRule("docs/old/", Redirect{ReplaceKeyPrefixWith: "docs/v1/"}),
+			prefixRule("docs/", Redirect{ReplaceKeyPrefixWith: "documents/"}),
+			prefixRule("moved.html", Redirect{ReplaceKeyWith: "index.html", Protocol: "https"}),
+			errorCodeRule("404", "images/", Redirect{HostName: "img.example.com"}),
+			errorCodeRule("404", "", Redirect{ReplaceKeyWith: "not-found.html"}),
+		},
+	}
+	testWebsiteHandler(t, config, []websiteCase{
+		{name: "index document", path: "/", code: http.StatusOK, body: "home"},
+		{name: "folder index document", path: "/about/", code: http.StatusOK, body: "about"},
+		{name: "folder without slash", path: "/about", code: http.StatusFound, location: "/about/"},
+		{name: "first matching rule wins", path: "/docs/old/a.html", code: http.StatusMovedPermanently, location: "http://example.com/docs/v1/a.html"},
+		{name: "rule before reading the object", path: "/docs/a.html", code: http.StatusMovedPermanently, location: "http://example.com/documents/a.html"},
+		{name: "replace key with protocol", path: "/moved.html", code: http.StatusMovedPermanently, location: "https://example.com/index.html"},
+		{name: "rule without redirect is skipped", path: "/ignored/a.html", code: http.StatusMovedPermanently, location: "http://example.com/not-found.html"},
+		{name: "error code rule not applied to found object", path: "/images/logo.png", code: http.StatusOK, body: "logo"},
+		{name: "error code rule with prefix", path: "/images/missing.png", code: http.StatusMovedPermanently, location: "http://img.example.com/images/missing.png"},
+		{name: "error code rule without prefix", path: "/missing.html", code: http.StatusMovedPermanently, location: "http://example.com/not-found.html"},
+		{name: "head", method: http.MethodHead, path: "/", code: http.StatusOK},
+		{name: "method not allowed", method: http.MethodPost, path: "/", code: http.StatusMethodNotAllowed},
+	})
+}
+
+func TestWebsiteHandlerRoutingRuleOrder(t *testing.T) {
+	// The broader prefix listed first shadows the narrower one
+	config := WebsiteConfiguration{
+		RoutingRules: []RoutingRule{
+			prefixRule("docs/", Redirect{ReplaceKeyPrefixWith: "documents/"}),
+			prefixRule("docs/old/", Redirect{ReplaceKeyPrefixWith: "docs/v1/"}),
+			errorCodeRule("404", "", Redirect{ReplaceKeyWith: "not-found.html"}),
+			errorCodeRule("404", "images/", Redirect{HostName: "img.example.com"}),
+		},
+	}
+	testWebsiteHandler(t, config, []websiteCase{
+		{name: "broader prefix first", path: "/docs/old/a.html", code: http.StatusMovedPermanently, location: "http://example.com/documents/old/a.html"},
+		{name: "error code rule without prefix first", path: "/images/missing.png", code: http.StatusMovedPermanently, location: "http://example.com/not-found.html"},
+		{name: "no index document", path: "/", code: http.StatusMovedPermanently, location: "http://example.com/not-found.html"},
+	})
+}
+
+func TestWebsiteHandlerErrorDocument(t *testing.T) {
+	testWebsiteHandler(t, WebsiteConfiguration{
+		IndexDocument: IndexDocument{Suffix: "index.html"},
+		ErrorDocument: ErrorDocument{Key: "error.html"},
+		RoutingRules:  []RoutingRule{errorCodeRule("403", "", Redirect{ReplaceKeyWith: "forbidden.html"})},
+	}, []websiteCase{
+		{name: "error document", path: "/missing.html", code: http.StatusNotFound, body: "error page"},
+		{name: "error code rule for another code", path: "/images/missing.png", code: http.StatusNotFound, body: "error page"},
+	})
+	testWebsiteHandler(t, WebsiteConfiguration{
+		ErrorDocument: ErrorDocument{Key: "missing-error.html"},
+	}, []websiteCase{
+		{name: "missing error document", path: "/missing.html", code: http.StatusNotFound},
+	})
+}
+
+func TestWebsiteHandlerRedirectAll(t *testing.T) {
+	testWebsiteHandler(t, WebsiteConfiguration{
+		IndexDocument:       IndexDocument{Suffix: "index.html"},
+		WebsiteAllRequestTo: &WebsiteAllRequestToXML{HostName: "www.example.org", Protocol: "https"},
+		RoutingRules:        []RoutingRule{prefixRule("docs/", Redirect{ReplaceKeyPrefixWith: "documents/"})},
+	}, []websiteCase{
+		{name: "redirect all", path: "/docs/a.html", code: http.StatusMovedPermanently, location: "https://www.example.org/docs/a.html"},
+		{name: "redirect root", path: "/", code: http.StatusMovedPermanently, location: "https://www.example.org/"},
+	})
+}
+
+func TestDirWebsiteSource(t *testing.T) {
+	root := t.TempDir()
+	site := filepath.Join(root, "site")
+	if err := os.MkdirAll(filepath.Join(site, "about"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		filepath.Join(site, "index.html"): "home",
+		filepath.Join(root, "secret.txt"): "secret",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		body string
+		err  error
+	}{
+		{"index.html", "home", nil},
+		{"missing.html", "", ErrWebsiteObjectNotFound},
+		{"about", "", ErrWebsiteObjectNotFound},
+		{"../secret.txt", "", ErrWebsiteObjectNotFound},
+		{"about/../index.html", "home", nil},
+	}
+	for _, tt := range tests {
+		body, header, err := DirWebsiteSource(site).Open(tt.key)
+		if err != tt.err {
+			t.Errorf("Open(%q) error = %v, want %v", tt.key, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != tt.body {
+			t.Errorf("Open(%q) = %q, want %q", tt.key, data, tt.body)
+		}
+		if got := header.Get(HTTPHeaderContentLength); got != "4" {
+			t.Errorf("Open(%q) Content-Length = %q, want 4", tt.key, got)
+		}
+	}
+}
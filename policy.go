@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func policyCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "policy",
+		Usage: "检查与管理存储桶策略",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "lint",
+				Usage:     "检查策略文件, 指定--bucket时同时检查资源是否属于该存储桶",
+				ArgsUsage: "<策略文件, - 表示标准输入>",
+				Action: func(ctx *cli.Context) error {
+					policy, err := readPolicy(ctx.Args().First())
+					if err != nil {
+						return err
+					}
+					if err = lintPolicy(policy, ctx.String("bucket")); err != nil {
+						return err
+					}
+					fmt.Println("策略检查通过")
+					return nil
+				},
+			},
+			{
+				Name:      "fmt",
+				Usage:     "格式化输出策略文件",
+				ArgsUsage: "<策略文件, - 表示标准输入>",
+				Action: func(ctx *cli.Context) error {
+					policy, err := readPolicy(ctx.Args().First())
+					if err != nil {
+						return err
+					}
+					return printPolicy(policy)
+				},
+			},
+			{
+				Name:  "get",
+				Usage: "查看存储桶策略",
+				Action: func(ctx *cli.Context) error {
+					bucket, err := requireBucket(ctx)
+					if err != nil {
+						return err
+					}
+					text, err := NewClient().GetBucketPolicy(bucket)
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					policy, err := oossdk.ParsePolicy(text)
+					if err != nil {
+						// 无法解析时原样输出
+						fmt.Println(text)
+						return nil
+					}
+					return printPolicy(policy)
+				},
+			},
+			{
+				Name:      "set",
+				Usage:     "检查策略文件并设置为存储桶策略",
+				ArgsUsage: "<策略文件, - 表示标准输入>",
+				Action: func(ctx *cli.Context) error {
+					bucket, err := requireBucket(ctx)
+					if err != nil {
+						return err
+					}
+					policy, err := readPolicy(ctx.Args().First())
+					if err != nil {
+						return err
+					}
+					if err = lintPolicy(policy, bucket); err != nil {
+						return err
+					}
+					if err = NewClient().SetBucketPolicyDocument(bucket, policy); err != nil {
+						return cli.Exit(err, 1)
+					}
+					fmt.Println("已设置存储桶策略", bucket)
+					return nil
+				},
+			},
+			{
+				Name:      "simulate",
+				Usage:     "在本地模拟请求, 判断策略是否允许该请求, 不指定策略文件时使用存储桶当前的策略",
+				ArgsUsage: "[策略文件, - 表示标准输入]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "principal",
+						Usage: "请求者ARN, 不指定时为匿名请求",
+					},
+					&cli.StringFlag{
+						Name:     "action",
+						Usage:    "操作, 如 s3:GetObject",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:    "key",
+						Aliases: []string{"k"},
+						Usage:   "对象名称, 不指定时为存储桶操作",
+					},
+					&cli.StringFlag{
+						Name:  "source-ip",
+						Usage: "请求来源IP",
+					},
+					&cli.StringFlag{
+						Name:  "referer",
+						Usage: "请求的Referer",
+					},
+					&cli.StringSliceFlag{
+						Name:  "context",
+						Usage: "其他条件键, 格式为 key=value, 如 s3:prefix=logs/",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					bucket, err := requireBucket(ctx)
+					if err != nil {
+						return err
+					}
+					var policy oossdk.Policy
+					if file := ctx.Args().First(); file != "" {
+						policy, err = readPolicy(file)
+					} else {
+						policy, err = bucketPolicy(bucket)
+					}
+					if err != nil {
+						return err
+					}
+					req := oossdk.PolicyRequest{
+						Principal: ctx.String("principal"),
+						Action:    ctx.String("action"),
+						Bucket:    bucket,
+						Key:       ctx.String("key"),
+						SourceIP:  ctx.String("source-ip"),
+						Referer:   ctx.String("referer"),
+						Context:   map[string]string{},
+					}
+					for _, kv := range ctx.StringSlice("context") {
+						k, v, ok := strings.Cut(kv, "=")
+						if !ok {
+							return cli.Exit(fmt.Sprintf("条件键格式错误: %s", kv), 1)
+						}
+						req.Context[k] = v
+					}
+					return printDecision(req, policy.Evaluate(req))
+				},
+			},
+		},
+	}
+}
+
+// requireBucket 返回--bucket指定的存储桶
+func requireBucket(ctx *cli.Context) (string, error) {
+	if bucket := ctx.String("bucket"); bucket != "" {
+		return bucket, nil
+	}
+	return "", cli.Exit("--bucket 必传", 1)
+}
+
+// readPolicy 读取并解析策略文件, file为-时从标准输入读取
+func readPolicy(file string) (oossdk.Policy, error) {
+	var data []byte
+	var err error
+	switch file {
+	case "":
+		return oossdk.Policy{}, cli.Exit("请指定策略文件", 1)
+	case "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return oossdk.Policy{}, cli.Exit(err, 1)
+	}
+	policy, err := oossdk.ParsePolicy(string(data))
+	if err != nil {
+		return policy, cli.Exit(err, 1)
+	}
+	return policy, nil
+}
+
+// lintPolicy 逐条输出策略中的问题
+func lintPolicy(policy oossdk.Policy, bucket string) error {
+	err := policy.Validate(bucket)
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(oossdk.PolicyValidationError); ok {
+		for _, problem := range e.Problems {
+			fmt.Println(problem)
+		}
+		return cli.Exit(fmt.Sprintf("策略检查未通过, 共 %d 个问题", len(e.Problems)), 1)
+	}
+	return cli.Exit(err, 1)
+}
+
+// bucketPolicy 获取并解析存储桶当前的策略
+func bucketPolicy(bucket string) (oossdk.Policy, error) {
+	text, err := NewClient().GetBucketPolicy(bucket)
+	if err != nil {
+		return oossdk.Policy{}, cli.Exit(err, 1)
+	}
+	policy, err := oossdk.ParsePolicy(text)
+	if err != nil {
+		return policy, cli.Exit(err, 1)
+	}
+	return policy, nil
+}
+
+// printDecision 输出模拟结果及决定结果的语句
+func printDecision(req oossdk.PolicyRequest, decision oossdk.PolicyDecision) error {
+	fmt.Printf("%s %s %s\n", decision.Effect, req.Action, req.Resource())
+	if decision.Statement == nil {
+		fmt.Println("没有匹配的语句, 默认拒绝")
+		return nil
+	}
+	name := fmt.Sprintf("第 %d 条语句", decision.Index)
+	if decision.Statement.Sid != "" {
+		name += fmt.Sprintf(" (%s)", decision.Statement.Sid)
+	}
+	fmt.Println("决定结果的语句:", name)
+	data, err := json.MarshalIndent(decision.Statement, "", "  ")
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func printPolicy(policy oossdk.Policy) error {
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Println(string(data))
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+// maxPresignExpires V4签名URL的最长有效期
+const maxPresignExpires = 7 * 24 * time.Hour
+
+func presignCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "presign",
+		Usage: "生成带签名的文件分享链接",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "key",
+				Usage:   "文件名",
+				Aliases: []string{"k"},
+			},
+			&cli.StringFlag{
+				Name:  "prefix",
+				Usage: "为前缀下的所有文件生成链接",
+			},
+			&cli.StringFlag{
+				Name:    "expires",
+				Usage:   "有效期, 如 30m, 24h, 7d, 最长7天",
+				Value:   "1h",
+				Aliases: []string{"e"},
+			},
+			&cli.StringFlag{
+				Name:  "method",
+				Usage: "请求方法, GET/PUT/HEAD/DELETE",
+				Value: "GET",
+			},
+			&cli.StringFlag{
+				Name:  "content-disposition",
+				Usage: "覆盖下载时响应的Content-Disposition, 如 attachment; filename=a.zip",
+			},
+			&cli.StringFlag{
+				Name:  "content-type",
+				Usage: "覆盖下载时响应的Content-Type",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			if ctx.String("key") == "" && ctx.String("prefix") == "" {
+				return cli.Exit("--key 或 --prefix 必传", 1)
+			}
+			expires, err := parseDuration(ctx.String("expires"))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			if expires <= 0 || expires > maxPresignExpires {
+				return cli.Exit("有效期须大于0且不超过7天", 1)
+			}
+			method := oossdk.HTTPMethod(strings.ToUpper(ctx.String("method")))
+			switch method {
+			case oossdk.HTTPGet, oossdk.HTTPPut, oossdk.HTTPHead, oossdk.HTTPDelete:
+			default:
+				return cli.Exit(fmt.Sprintf("不支持的请求方法: %s", method), 1)
+			}
+			var options []oossdk.Option
+			if v := ctx.String("content-disposition"); v != "" {
+				options = append(options, oossdk.ResponseContentDisposition(v))
+			}
+			if v := ctx.String("content-type"); v != "" {
+				options = append(options, oossdk.ResponseContentType(v))
+			}
+
+			oos := NewOos(ctx)
+			if ctx.String("key") != "" {
+				return oos.presign(ctx.String("key"), method, expires, options)
+			}
+			return oos.presignPrefix(ctx.String("prefix"), method, expires, options)
+		},
+	}
+}
+
+func (oos *Oos) presign(key string, method oossdk.HTTPMethod, expires time.Duration, options []oossdk.Option) error {
+	url, err := oos.bucket.SignURL(key, method, int64(expires/time.Second), options...)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Println(url)
+	return nil
+}
+
+// presignPrefix 为前缀下的每个文件生成链接, 每行输出文件名与链接, 以制表符分隔
+func (oos *Oos) presignPrefix(prefix string, method oossdk.HTTPMethod, expires time.Duration, options []oossdk.Option) error {
+	objects, err := listObjects(oos.bucket, prefix)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	for _, object := range objects {
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		url, err := oos.bucket.SignURL(object.Key, method, int64(expires/time.Second), options...)
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		fmt.Printf("%s\t%s\n", object.Key, url)
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+// 发布布局: <prefix>releases/<name>/ 存放文件, <prefix>releases/<name>.json 为清单,
+// 清单在所有文件校验通过后才写入, 只有存在清单的版本才是完整的版本; <prefix>current 的内容为当前版本名称
+const (
+	releasesDir    = "releases/"
+	releasePointer = "current"
+)
+
+func releaseCmd() *cli.Command {
+	prefixFlag := &cli.StringFlag{
+		Name:  "prefix",
+		Usage: "存储桶前缀, 按目录处理, 版本存放在 <prefix>releases/ 下, 当前版本指针为 <prefix>current",
+	}
+	return &cli.Command{
+		Name:  "release",
+		Usage: "发布、回滚与清理版本, 使用方只会读到完整上传的版本",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "publish",
+				Usage:     "上传目录为新版本, 校验所有文件后写入清单并切换当前版本",
+				ArgsUsage: "<目录>",
+				Flags: []cli.Flag{
+					prefixFlag,
+					&cli.StringFlag{
+						Name:     "name",
+						Usage:    "版本名称, 如 v1.2.3",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:    "concurrent",
+						Usage:   "并发数量",
+						Value:   10,
+						Aliases: []string{"c"},
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					dir := ctx.Args().First()
+					if dir == "" {
+						return cli.Exit("请指定目录", 1)
+					}
+					r := newReleases(ctx)
+					return r.publish(filepath.Clean(dir), ctx.String("name"), ctx.Int("concurrent"))
+				},
+			},
+			{
+				Name:      "rollback",
+				Usage:     "将当前版本切换为指定版本, 不指定时切换为当前版本之前发布的版本",
+				ArgsUsage: "[版本名称]",
+				Flags:     []cli.Flag{prefixFlag},
+				Action: func(ctx *cli.Context) error {
+					return newReleases(ctx).rollback(ctx.Args().First())
+				},
+			},
+			{
+				Name:  "prune",
+				Usage: "删除旧版本, 当前版本总是保留",
+				Flags: []cli.Flag{
+					prefixFlag,
+					&cli.IntFlag{
+						Name:  "keep",
+						Usage: "保留最近发布的版本数量",
+						Value: 5,
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "只输出将要删除的版本",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.Int("keep") < 1 {
+						return cli.Exit("--keep 至少为1", 1)
+					}
+					return newReleases(ctx).prune(ctx.Int("keep"), ctx.Bool("dry-run"))
+				},
+			},
+			{
+				Name:  "ls",
+				Usage: "查看所有完整的版本, *表示当前版本",
+				Flags: []cli.Flag{prefixFlag},
+				Action: func(ctx *cli.Context) error {
+					return newReleases(ctx).list()
+				},
+			},
+		},
+	}
+}
+
+// releaseManifest 版本清单, 文件名为相对于版本目录的路径
+type releaseManifest struct {
+	Name        string        `json:"name"`
+	PublishedAt time.Time     `json:"publishedAt"`
+	Files       []releaseFile `json:"files"`
+}
+
+type releaseFile struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+func (m *releaseManifest) size() int64 {
+	var size int64
+	for _, f := range m.Files {
+		size += f.Size
+	}
+	return size
+}
+
+type releases struct {
+	oos    *Oos
+	prefix string
+}
+
+func newReleases(ctx *cli.Context) *releases {
+	return &releases{oos: NewOos(ctx), prefix: dirPrefix(ctx.String("prefix"))}
+}
+
+func (r *releases) dir(name string) string {
+	return r.prefix + releasesDir + name + "/"
+}
+
+func (r *releases) manifestKey(name string) string {
+	return r.prefix + releasesDir + name + ".json"
+}
+
+func checkReleaseName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return fmt.Errorf("版本名称无效: %q", name)
+	}
+	return nil
+}
+
+func (r *releases) publish(dir, name string, concurrent int) error {
+	if err := checkReleaseName(name); err != nil {
+		return cli.Exit(err, 1)
+	}
+	// 已发布的版本可能正在被使用, 不允许覆盖; 没有清单的目录是上次失败的发布, 可以覆盖
+	exists, err := r.oos.bucket.IsObjectExist(r.manifestKey(name))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if exists {
+		return cli.Exit(fmt.Sprintf("版本 %s 已存在", name), 1)
+	}
+	files, err := walkLocal(dir)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if len(files) == 0 {
+		return cli.Exit(fmt.Sprintf("目录 %s 中没有文件", dir), 1)
+	}
+
+	manifest := &releaseManifest{Name: name}
+	var mu sync.Mutex
+	stat := &syncStat{}
+	runConcurrent(concurrent, func(run func(func())) {
+		for _, f := range files {
+			f := f
+			run(func() {
+				key := r.dir(name) + f.key
+				if err := r.oos.bucket.PutObjectFromFile(key, f.path); err != nil {
+					stat.fail(f.path, err)
+					return
+				}
+				etag, err := r.verify(key, f)
+				if err != nil {
+					stat.fail(f.path, err)
+					return
+				}
+				mu.Lock()
+				manifest.Files = append(manifest.Files, releaseFile{Key: f.key, Size: f.size, ETag: etag})
+				mu.Unlock()
+				if r.oos.verbose {
+					fmt.Println("上传文件", key)
+				}
+			})
+		}
+	})
+	if len(stat.failed) > 0 {
+		for _, v := range stat.failed {
+			fmt.Println(v)
+		}
+		return cli.Exit(fmt.Sprintf("发布失败, %d 个文件未通过, 当前版本未改变", len(stat.failed)), 1)
+	}
+	// 上次失败的发布可能在目录中留下本次没有的文件, 写入清单前删除, 以免版本目录中有清单之外的文件
+	objects, err := listObjects(r.oos.bucket, r.dir(name))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	var stale []string
+	for _, obj := range objects {
+		if _, ok := files[strings.TrimPrefix(obj.Key, r.dir(name))]; !ok {
+			stale = append(stale, obj.Key)
+		}
+	}
+	if _, err = r.oos.deleteObjects(stale); err != nil {
+		return cli.Exit(fmt.Sprintf("删除上次发布残留的文件失败, 当前版本未改变: %v", err), 1)
+	}
+
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Key < manifest.Files[j].Key })
+	manifest.PublishedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if err = r.oos.bucket.PutObject(r.manifestKey(name), bytes.NewReader(data)); err != nil {
+		return cli.Exit(err, 1)
+	}
+	if err = r.setCurrent(name); err != nil {
+		return err
+	}
+	fmt.Printf("已发布版本 %s, 共 %d 个文件 %s\n", name, len(manifest.Files), humanFileSize(float64(manifest.size())))
+	return nil
+}
+
+// verify 通过HeadObject确认对象已完整写入, 返回对象的ETag
+func (r *releases) verify(key string, f localFile) (string, error) {
+	header, err := r.oos.bucket.HeadObject(key)
+	if err != nil {
+		return "", err
+	}
+	size, _ := strconv.ParseInt(header.Get(oossdk.HTTPHeaderContentLength), 10, 64)
+	if size != f.size {
+		return "", fmt.Errorf("大小不一致, 本地 %d, 存储桶 %d", f.size, size)
+	}
+	etag := strings.Trim(header.Get(oossdk.HTTPHeaderEtag), "\"")
+	obj := oossdk.ObjectProperties{Key: key, Size: size, ETag: etag}
+	if !strings.Contains(etag, "-") {
+		same, err := sameContent(f, obj)
+		if err != nil {
+			return "", err
+		}
+		if !same {
+			return "", fmt.Errorf("内容校验失败, ETag %s", etag)
+		}
+	}
+	return etag, nil
+}
+
+func (r *releases) setCurrent(name string) error {
+	err := r.oos.bucket.PutObject(r.prefix+releasePointer, strings.NewReader(name),
+		oossdk.ContentType("text/plain; charset=utf-8"), oossdk.CacheControl(cacheControlNoCache))
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	fmt.Println("当前版本", name)
+	return nil
+}
+
+// current 读取当前版本名称, 未发布过时返回空
+func (r *releases) current() (string, error) {
+	body, err := r.oos.bucket.GetObject(r.prefix + releasePointer)
+	if err != nil {
+		if e, ok := err.(oossdk.ServiceError); ok && e.Code == "NoSuchKey" {
+			return "", nil
+		}
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	return strings.TrimSpace(string(data)), err
+}
+
+// manifests 读取所有完整版本的清单, 按发布时间从新到旧排列
+func (r *releases) manifests() ([]*releaseManifest, error) {
+	var manifests []*releaseManifest
+	marker := ""
+	for {
+		lor, err := r.oos.bucket.ListObjects(oossdk.Prefix(r.prefix+releasesDir), oossdk.Delimiter("/"),
+			oossdk.Marker(marker), oossdk.MaxKeys(1000))
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range lor.Objects {
+			if !strings.HasSuffix(obj.Key, ".json") {
+				continue
+			}
+			m, err := r.readManifest(obj.Key)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", obj.Key, err)
+			}
+			manifests = append(manifests, m)
+		}
+		if !lor.IsTruncated {
+			break
+		}
+		marker = lor.NextMarker
+		if marker == "" && len(lor.Objects) > 0 {
+			marker = lor.Objects[len(lor.Objects)-1].Key
+		}
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].PublishedAt.After(manifests[j].PublishedAt) })
+	return manifests, nil
+}
+
+func (r *releases) readManifest(key string) (*releaseManifest, error) {
+	body, err := r.oos.bucket.GetObject(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	m := &releaseManifest{}
+	if err = json.NewDecoder(body).Decode(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (r *releases) rollback(name string) error {
+	current, err := r.current()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	manifests, err := r.manifests()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	if name == "" {
+		if current == "" {
+			return cli.Exit("尚未发布任何版本", 1)
+		}
+		// 当前版本之后发布的版本不作为回滚目标
+		found := false
+		for _, m := range manifests {
+			if found {
+				name = m.Name
+				break
+			}
+			found = m.Name == current
+		}
+		if name == "" {
+			return cli.Exit(fmt.Sprintf("当前版本 %s 之前没有可回滚的版本", current), 1)
+		}
+	}
+	for _, m := range manifests {
+		if m.Name == name {
+			if name == current {
+				fmt.Println("当前版本已是", name)
+				return nil
+			}
+			return r.setCurrent(name)
+		}
+	}
+	return cli.Exit(fmt.Sprintf("版本 %s 不存在或未发布完成", name), 1)
+}
+
+func (r *releases) prune(keep int, dryRun bool) error {
+	current, err := r.current()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	manifests, err := r.manifests()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	var removed int
+	for i, m := range manifests {
+		if i < keep || m.Name == current {
+			continue
+		}
+		if dryRun {
+			fmt.Println("删除版本", m.Name)
+			continue
+		}
+		// 先删除清单, 使该版本不再被视为完整的版本, 再删除文件
+		if err = r.oos.bucket.DeleteObject(r.manifestKey(m.Name)); err != nil {
+			return cli.Exit(err, 1)
+		}
+		objects, err := listObjects(r.oos.bucket, r.dir(m.Name))
+		if err != nil {
+			return cli.Exit(err, 1)
+		}
+		keys := make([]string, len(objects))
+		for i, obj := range objects {
+			keys[i] = obj.Key
+		}
+		if _, err = r.oos.deleteObjects(keys); err != nil {
+			return cli.Exit(err, 1)
+		}
+		fmt.Println("已删除版本", m.Name)
+		removed++
+	}
+	if !dryRun {
+		fmt.Printf("共删除 %d 个版本\n", removed)
+	}
+	return nil
+}
+
+func (r *releases) list() error {
+	current, err := r.current()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	manifests, err := r.manifests()
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tName\tPublished\tFiles\tSize")
+	for _, m := range manifests {
+		mark := ""
+		if m.Name == current {
+			mark = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", mark, m.Name, m.PublishedAt.Local().Format("2006-01-02 15:04:05"),
+			len(m.Files), humanFileSize(float64(m.size())))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/pelletier/go-toml"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	keyVerifyAttempts = 5
+	keyVerifyInterval = 2 * time.Second
+)
+
+func keysRotateCmd() *cli.Command {
+	return &cli.Command{
+		Name: "rotate",
+		Usage: "轮换当前配置使用的密钥: 创建新密钥并验证可用后写入配置文件, 再禁用旧密钥. " +
+			"指定--bucket时通过列出该存储桶验证, 否则列出存储桶列表",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "上次轮换的旧密钥尚未删除时仍然轮换",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			config := loadConfig()
+			if pending, _ := config.Get("rotatedKey").(string); pending != "" && !ctx.Bool("force") {
+				return cli.Exit(fmt.Sprintf("上次轮换的旧密钥 %s 尚未删除, 请先执行 keys retire, 或指定--force", pending), 1)
+			}
+			oldKey, _ := config.Get("accessKey").(string)
+
+			iam := NewIAMClient()
+			out, err := iam.CreateAccessKey("")
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			key := out.CreateAccessKeyResult.AcessKey
+			fmt.Println("已创建访问密钥", key.AccessKeyId)
+
+			config.Set("accessKey", key.AccessKeyId)
+			config.Set("secretKey", key.SecretAccessKey)
+			if err = verifyKey(config, ctx.String("bucket")); err != nil {
+				if _, delErr := iam.DeleteAccessKey(key.AccessKeyId, ""); delErr != nil {
+					fmt.Printf("删除新密钥 %s 失败, 请手动删除: %v\n", key.AccessKeyId, delErr)
+				}
+				return cli.Exit(fmt.Sprintf("新密钥验证失败, 配置文件未修改: %v", err), 1)
+			}
+			fmt.Println("新密钥验证通过")
+
+			config.Set("rotatedKey", oldKey)
+			config.Set("rotatedAt", time.Now().UTC().Truncate(time.Second))
+			backup, err := saveConfig(config, true)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("写入配置文件失败, 旧密钥仍可使用. 新密钥 %s 的SecretAccessKey为 %s, 请手动保存或删除: %v",
+					key.AccessKeyId, key.SecretAccessKey, err), 1)
+			}
+			fmt.Println("已更新配置文件", configFile(), "原配置备份为", backup)
+
+			// 此时配置文件已是新密钥, 禁用旧密钥同时验证新密钥可以访问IAM接口
+			if err = NewIAMClient().UpdateAccessKey(oldKey, false); err != nil {
+				return cli.Exit(fmt.Sprintf("禁用旧密钥失败, 请执行 keys disable %s: %v", oldKey, err), 1)
+			}
+			fmt.Println("已禁用旧密钥", oldKey)
+			fmt.Println("确认没有其他程序使用旧密钥后, 执行 keys retire 删除旧密钥")
+			return nil
+		},
+	}
+}
+
+func keysRetireCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "retire",
+		Usage: "删除 keys rotate 禁用的旧密钥, 需在宽限期之后执行",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "grace",
+				Usage: "宽限期, 如 7d, 1d12h",
+				Value: "7d",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "宽限期内或旧密钥已重新启用时仍然删除",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			grace, err := parseDuration(ctx.String("grace"))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			config := loadConfig()
+			oldKey, _ := config.Get("rotatedKey").(string)
+			if oldKey == "" {
+				return cli.Exit("没有待删除的旧密钥", 1)
+			}
+			client := NewIAMClient()
+			if !ctx.Bool("force") {
+				if rotatedAt, ok := config.Get("rotatedAt").(time.Time); ok {
+					if deadline := rotatedAt.Add(grace); time.Now().Before(deadline) {
+						return cli.Exit(fmt.Sprintf("旧密钥 %s 于 %s 禁用, 宽限期至 %s, 确认删除请指定--force", oldKey,
+							rotatedAt.Local().Format("2006-01-02 15:04:05"), deadline.Local().Format("2006-01-02 15:04:05")), 1)
+					}
+				}
+				keys, err := listAccessKeys(client, "")
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				for _, key := range keys {
+					if key.id == oldKey && key.status != "Inactive" {
+						return cli.Exit(fmt.Sprintf("旧密钥 %s 的状态为 %s, 可能仍在使用, 确认删除请指定--force", oldKey, key.status), 1)
+					}
+				}
+			}
+			if _, err = client.DeleteAccessKey(oldKey, ""); err != nil && !isNoSuchEntity(err) {
+				return cli.Exit(err, 1)
+			}
+			config.Delete("rotatedKey")
+			config.Delete("rotatedAt")
+			// 不覆盖轮换前的备份, 以便恢复旧配置
+			if _, err = saveConfig(config, false); err != nil {
+				return cli.Exit(fmt.Sprintf("旧密钥已删除, 但写入配置文件失败, 请手动删除rotatedKey与rotatedAt: %v", err), 1)
+			}
+			fmt.Println("已删除旧密钥", oldKey)
+			return nil
+		},
+	}
+}
+
+// verifyKey 使用配置中的密钥列出存储桶中的文件, 未指定存储桶时列出存储桶列表. 新密钥生效可能有延迟, 失败时重试
+func verifyKey(config *toml.Tree, bucket string) error {
+	client := newClient(config.Get("endpoint").(string), config)
+	var err error
+	for i := 0; i < keyVerifyAttempts; i++ {
+		if i > 0 {
+			time.Sleep(keyVerifyInterval)
+		}
+		if bucket != "" {
+			var b *oossdk.Object
+			if b, err = client.Bucket(bucket); err == nil {
+				_, err = b.ListObjects(oossdk.MaxKeys(1))
+			}
+		} else {
+			_, err = client.ListBuckets()
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// isNoSuchEntity 密钥不存在, 已被删除时视为删除成功
+func isNoSuchEntity(err error) bool {
+	e, ok := err.(oossdk.ServiceError)
+	return ok && (e.Code == "NoSuchEntity" || e.StatusCode == http.StatusNotFound)
+}
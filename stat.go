@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func statCmd() *cli.Command {
+	return &cli.Command{
+		Name:    "stat",
+		Aliases: []string{"head"},
+		Usage:   "查看文件元数据",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "key",
+				Usage:    "文件名",
+				Aliases:  []string{"k"},
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "以JSON格式输出",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			return NewOos(ctx).statFile(ctx.String("key"), ctx.Bool("json"))
+		},
+	}
+}
+
+// objectStat 文件元数据, Meta为去掉x-amz-meta-前缀的自定义元数据
+type objectStat struct {
+	Key                string            `json:"key"`
+	Size               int64             `json:"size"`
+	ETag               string            `json:"etag"`
+	ContentType        string            `json:"contentType"`
+	CacheControl       string            `json:"cacheControl,omitempty"`
+	ContentDisposition string            `json:"contentDisposition,omitempty"`
+	ContentEncoding    string            `json:"contentEncoding,omitempty"`
+	StorageClass       string            `json:"storageClass"`
+	LastModified       time.Time         `json:"lastModified"`
+	Meta               map[string]string `json:"meta,omitempty"`
+}
+
+func newObjectStat(key string, header http.Header) objectStat {
+	stat := objectStat{
+		Key:                key,
+		ETag:               strings.Trim(header.Get(oossdk.HTTPHeaderEtag), "\""),
+		ContentType:        header.Get(oossdk.HTTPHeaderContentType),
+		CacheControl:       header.Get(oossdk.HTTPHeaderCacheControl),
+		ContentDisposition: header.Get(oossdk.HTTPHeaderContentDisposition),
+		ContentEncoding:    header.Get(oossdk.HTTPHeaderContentEncoding),
+		StorageClass:       header.Get(oossdk.HTTPHeaderoosStorageClass),
+		Meta:               map[string]string{},
+	}
+	stat.Size, _ = strconv.ParseInt(header.Get(oossdk.HTTPHeaderContentLength), 10, 64)
+	stat.LastModified, _ = http.ParseTime(header.Get(oossdk.HTTPHeaderLastModified))
+	// 标准存储不返回存储类型
+	if stat.StorageClass == "" {
+		stat.StorageClass = string(oossdk.StorageClassStandard)
+	}
+	for k := range header {
+		name := strings.ToLower(k)
+		if strings.HasPrefix(name, oossdk.HTTPHeaderoosMetaPrefix) {
+			stat.Meta[strings.TrimPrefix(name, oossdk.HTTPHeaderoosMetaPrefix)] = header.Get(k)
+		}
+	}
+	return stat
+}
+
+func (oos *Oos) statFile(key string, asJSON bool) error {
+	header, err := oos.bucket.HeadObject(key)
+	if err != nil {
+		// HEAD请求的错误响应没有消息体, 需再次确认是否为文件不存在
+		if ok, e := oos.bucket.IsObjectExist(key); e == nil && !ok {
+			return cli.Exit(errFileNotExists, 1)
+		}
+		return cli.Exit(err, 1)
+	}
+	stat := newObjectStat(key, header)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(stat); err != nil {
+			return cli.Exit(err, 1)
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Key\t%s\n", stat.Key)
+	fmt.Fprintf(w, "Size\t%s (%d)\n", humanFileSize(float64(stat.Size)), stat.Size)
+	fmt.Fprintf(w, "ETag\t%s\n", stat.ETag)
+	fmt.Fprintf(w, "Content-Type\t%s\n", stat.ContentType)
+	for _, v := range [][2]string{
+		{oossdk.HTTPHeaderCacheControl, stat.CacheControl},
+		{oossdk.HTTPHeaderContentDisposition, stat.ContentDisposition},
+		{oossdk.HTTPHeaderContentEncoding, stat.ContentEncoding},
+	} {
+		if v[1] != "" {
+			fmt.Fprintf(w, "%s\t%s\n", v[0], v[1])
+		}
+	}
+	fmt.Fprintf(w, "Storage-Class\t%s\n", stat.StorageClass)
+	fmt.Fprintf(w, "Last-Modified\t%s\n", stat.LastModified.Local().Format("2006-01-02 15:04:05"))
+	names := make([]string, 0, len(stat.Meta))
+	for name := range stat.Meta {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s%s\t%s\n", oossdk.HTTPHeaderoosMetaPrefix, name, stat.Meta[name])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/gosuri/uilive"
+	"github.com/urfave/cli/v2"
+)
+
+func syncCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "sync",
+		Usage: "同步本地目录与存储桶前缀, 只传输新增或变更的文件",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "dir",
+				Usage:    "本地目录",
+				Aliases:  []string{"d"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "prefix",
+				Usage: "存储桶前缀",
+			},
+			&cli.BoolFlag{
+				Name:  "download",
+				Usage: "从存储桶同步到本地 (默认从本地同步到存储桶)",
+			},
+			&cli.BoolFlag{
+				Name:  "delete",
+				Usage: "删除目标端中源端已不存在的文件, 前缀按目录处理",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "未指定--prefix时允许--delete删除整个存储桶中本地已不存在的文件",
+			},
+			&cli.IntFlag{
+				Name:    "concurrent",
+				Usage:   "并发数量",
+				Value:   10,
+				Aliases: []string{"c"},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			oos := NewOos(ctx)
+			prefix := dirPrefix(ctx.String("prefix"))
+			if ctx.Bool("download") {
+				return oos.syncDown(ctx.String("dir"), prefix, ctx.Int("concurrent"), ctx.Bool("delete"))
+			}
+			if ctx.Bool("delete") {
+				if err := checkMirrorPrefix(prefix, ctx.Bool("force")); err != nil {
+					return err
+				}
+			}
+			return oos.syncUp(ctx.String("dir"), prefix, ctx.Int("concurrent"), ctx.Bool("delete"))
+		},
+	}
+}
+
+// dirPrefix 将非空前缀补全为以/结尾的目录, 以免 site 匹配到 site-old/ 下的文件
+func dirPrefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		return prefix + "/"
+	}
+	return prefix
+}
+
+// checkMirrorPrefix 删除存储桶中的文件时, 空前缀会以整个存储桶为范围, 需指定--force确认
+func checkMirrorPrefix(prefix string, force bool) error {
+	if prefix == "" && !force {
+		return cli.Exit("未指定--prefix时--delete会删除整个存储桶中本地已不存在的文件, 确认请指定--force", 1)
+	}
+	return nil
+}
+
+// localPath 将对象相对于前缀的路径拼接到本地目录下, 含有../等解析到目录之外的路径时返回错误
+func localPath(dir, rel string) (string, error) {
+	output := filepath.Join(dir, filepath.FromSlash(rel))
+	r, err := filepath.Rel(dir, output)
+	if err != nil || r == "." || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("文件路径超出目录 %s", dir)
+	}
+	return output, nil
+}
+
+// localFile 本地文件信息, key为相对于同步目录的路径
+type localFile struct {
+	key     string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// syncStat 同步结果统计
+type syncStat struct {
+	added   int32
+	updated int32
+	skipped int32
+	removed int32
+	mu      sync.Mutex
+	failed  []string
+}
+
+func (s *syncStat) fail(name string, err error) {
+	s.mu.Lock()
+	s.failed = append(s.failed, fmt.Sprintf("%s: %v", name, err))
+	s.mu.Unlock()
+}
+
+// print 输出同步结果, 有失败的文件时返回错误, 使命令以非0状态退出
+func (s *syncStat) print() error {
+	fmt.Printf("同步完成, 新增 %d 个, 更新 %d 个, 删除 %d 个, 跳过 %d 个", s.added, s.updated, s.removed, s.skipped)
+	if len(s.failed) > 0 {
+		fmt.Printf(", 失败 %d 个\n", len(s.failed))
+		for _, v := range s.failed {
+			fmt.Println(v)
+		}
+		return cli.Exit("同步未完成", 1)
+	}
+	fmt.Println()
+	return nil
+}
+
+// walkLocal 列出目录下的所有文件
+func walkLocal(dir string) (map[string]localFile, error) {
+	files := map[string]localFile{}
+	err := filepath.WalkDir(dir, func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		files[key] = localFile{key: key, path: fpath, size: fi.Size(), modTime: fi.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+// fileMD5 计算本地文件的MD5(十六进制)
+func fileMD5(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := md5.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sameContent 在大小一致的前提下通过ETag比较内容, 分片上传的ETag不是MD5, 无法比较时视为不同
+func sameContent(f localFile, obj oossdk.ObjectProperties) (bool, error) {
+	etag := strings.Trim(obj.ETag, "\"")
+	if etag == "" || strings.Contains(etag, "-") {
+		return false, nil
+	}
+	sum, err := fileMD5(f.path)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(sum, etag), nil
+}
+
+// needUpload 本地文件比对象新时才比较内容, 上传后对象的修改时间总是晚于本地文件
+func needUpload(f localFile, obj oossdk.ObjectProperties) (bool, error) {
+	if f.size != obj.Size {
+		return true, nil
+	}
+	if !f.modTime.After(obj.LastModified) {
+		return false, nil
+	}
+	same, err := sameContent(f, obj)
+	return !same, err
+}
+
+// needDownload 下载后本地文件的修改时间会被设置为对象的修改时间, 时间不一致时才比较内容
+func needDownload(f localFile, obj oossdk.ObjectProperties) (bool, error) {
+	if f.size != obj.Size {
+		return true, nil
+	}
+	if f.modTime.Truncate(time.Second).Equal(obj.LastModified.Truncate(time.Second)) {
+		return false, nil
+	}
+	same, err := sameContent(f, obj)
+	return !same, err
+}
+
+// syncUp 将本地目录同步到存储桶前缀, mirror为true时删除本地已不存在的文件
+func (oos *Oos) syncUp(dir, prefix string, concurrent int, mirror bool) error {
+	dir = filepath.Clean(dir)
+	files, err := walkLocal(dir)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	objects, err := listObjects(oos.bucket, prefix)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	remote := make(map[string]oossdk.ObjectProperties, len(objects))
+	for _, obj := range objects {
+		remote[obj.Key] = obj
+	}
+
+	stat := &syncStat{}
+	w := uilive.New()
+	w.Start()
+	var c int32
+	runConcurrent(concurrent, func(run func(func())) {
+		for _, f := range files {
+			f := f
+			key := prefix + f.key
+			run(func() {
+				obj, exists := remote[key]
+				if exists {
+					ok, err := needUpload(f, obj)
+					if err != nil {
+						stat.fail(f.path, err)
+						return
+					}
+					if !ok {
+						atomic.AddInt32(&stat.skipped, 1)
+						return
+					}
+				}
+				if err := oos.bucket.PutObjectFromFile(key, f.path); err != nil {
+					stat.fail(f.path, err)
+					return
+				}
+				if exists {
+					atomic.AddInt32(&stat.updated, 1)
+				} else {
+					atomic.AddInt32(&stat.added, 1)
+				}
+				if oos.verbose {
+					fmt.Println("上传文件", key)
+				} else {
+					fmt.Fprintf(w, "已同步%d个文件\n", atomic.AddInt32(&c, 1))
+				}
+			})
+		}
+	})
+	w.Stop()
+	// 有文件同步失败时不删除, 以免误删
+	if mirror && len(stat.failed) == 0 {
+		var stale []string
+		for key := range remote {
+			rel := strings.TrimPrefix(key, prefix)
+			if _, ok := files[rel]; !ok && !strings.HasSuffix(key, "/") {
+				stale = append(stale, key)
+			}
+		}
+		n, err := oos.deleteObjects(stale)
+		stat.removed = int32(n)
+		if err != nil {
+			stat.fail("删除文件", err)
+		}
+	}
+	return stat.print()
+}
+
+// syncDown 将存储桶前缀同步到本地目录, mirror为true时删除存储桶中已不存在的本地文件
+func (oos *Oos) syncDown(dir, prefix string, concurrent int, mirror bool) error {
+	dir = filepath.Clean(dir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return cli.Exit(err, 1)
+	}
+	files, err := walkLocal(dir)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+	objects, err := listObjects(oos.bucket, prefix)
+	if err != nil {
+		return cli.Exit(err, 1)
+	}
+
+	stat := &syncStat{}
+	w := uilive.New()
+	w.Start()
+	var c int32
+	runConcurrent(concurrent, func(run func(func())) {
+		for _, obj := range objects {
+			obj := obj
+			rel := strings.TrimPrefix(obj.Key, prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				continue
+			}
+			output, err := localPath(dir, rel)
+			if err != nil {
+				stat.fail(obj.Key, err)
+				continue
+			}
+			run(func() {
+				f, exists := files[rel]
+				if exists {
+					ok, err := needDownload(f, obj)
+					if err != nil {
+						stat.fail(obj.Key, err)
+						return
+					}
+					if !ok {
+						atomic.AddInt32(&stat.skipped, 1)
+						return
+					}
+				}
+				if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+					stat.fail(obj.Key, err)
+					return
+				}
+				if err := oos.bucket.GetObjectToFile(obj.Key, output); err != nil {
+					stat.fail(obj.Key, err)
+					return
+				}
+				// 修改时间未设置时下次同步会误判文件是否变化
+				if err := os.Chtimes(output, obj.LastModified, obj.LastModified); err != nil {
+					stat.fail(obj.Key, err)
+					return
+				}
+				if exists {
+					atomic.AddInt32(&stat.updated, 1)
+				} else {
+					atomic.AddInt32(&stat.added, 1)
+				}
+				if oos.verbose {
+					fmt.Println("下载文件", obj.Key)
+				} else {
+					fmt.Fprintf(w, "已同步%d个文件\n", atomic.AddInt32(&c, 1))
+				}
+			})
+		}
+	})
+	w.Stop()
+	if mirror && len(stat.failed) == 0 {
+		remote := make(map[string]bool, len(objects))
+		for _, obj := range objects {
+			remote[strings.TrimPrefix(obj.Key, prefix)] = true
+		}
+		for rel, f := range files {
+			if remote[rel] {
+				continue
+			}
+			if err := os.Remove(f.path); err != nil {
+				stat.fail(f.path, err)
+				continue
+			}
+			stat.removed++
+			if oos.verbose {
+				fmt.Println("删除文件", f.path)
+			}
+		}
+	}
+	return stat.print()
+}
+
+// runConcurrent 以最多concurrent个协程执行schedule中提交的任务, 所有任务结束后返回
+func runConcurrent(concurrent int, schedule func(run func(func()))) {
+	if concurrent < 1 {
+		concurrent = 1
+	}
+	wg := sync.WaitGroup{}
+	ch := make(chan struct{}, concurrent)
+	defer close(ch)
+	schedule(func(task func()) {
+		ch <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-ch
+				wg.Done()
+			}()
+			task()
+		}()
+	})
+	wg.Wait()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	oossdk "ctyun-oos-upload/oos"
+
+	"github.com/urfave/cli/v2"
+)
+
+func websiteCmd() *cli.Command {
+	return &cli.Command{
+		Name:  "website",
+		Usage: "静态网站托管",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "serve",
+				Usage:     "按存储桶静态网站规则在本地预览网站, 不指定配置文件时使用存储桶当前的规则",
+				ArgsUsage: "[网站配置文件, .toml为存储桶配置文件, 其他按XML解析]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "dir",
+						Usage: "网站文件所在的本地目录, 不指定时读取存储桶中的文件",
+					},
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "读取存储桶中该前缀下的文件",
+					},
+					&cli.StringFlag{
+						Name:  "index",
+						Usage: "默认首页, 覆盖配置中的IndexDocument",
+					},
+					&cli.StringFlag{
+						Name:  "error",
+						Usage: "错误页面, 覆盖配置中的ErrorDocument",
+					},
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "监听地址",
+						Value: "127.0.0.1:8080",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					config, err := websiteConfigArg(ctx)
+					if err != nil {
+						return cli.Exit(err, 1)
+					}
+					var source oossdk.WebsiteSource
+					if dir := ctx.String("dir"); dir != "" {
+						source = oossdk.DirWebsiteSource(dir)
+					} else {
+						source = oossdk.BucketWebsiteSource{Bucket: NewOos(ctx).bucket, Prefix: ctx.String("prefix")}
+					}
+					handler := oossdk.NewWebsiteHandler(config, source)
+					fmt.Printf("正在监听 http://%s, 首页 %s, 错误页面 %s\n", ctx.String("addr"),
+						config.IndexDocument.Suffix, config.ErrorDocument.Key)
+					if err = http.ListenAndServe(ctx.String("addr"), logRequests(handler)); err != nil {
+						return cli.Exit(err, 1)
+					}
+					return nil
+				},
+			},
+			websiteDeployCmd(),
+		},
+	}
+}
+
+// websiteConfigArg 读取网站配置文件或存储桶当前的网站配置, 再以--index与--error覆盖
+func websiteConfigArg(ctx *cli.Context) (oossdk.WebsiteConfiguration, error) {
+	var config oossdk.WebsiteConfiguration
+	var err error
+	if file := ctx.Args().First(); file != "" {
+		if config, err = readWebsiteConfig(file); err != nil {
+			return config, err
+		}
+	} else if bucket := ctx.String("bucket"); bucket != "" {
+		website, err := NewClient().GetBucketWebsite(bucket)
+		if err != nil && !isNotConfigured(err) {
+			return config, err
+		}
+		if c := newWebsiteConfig(website); c != nil {
+			config = c.toSDK()
+		}
+	}
+	if index := ctx.String("index"); index != "" {
+		config.IndexDocument.Suffix = index
+	}
+	if doc := ctx.String("error"); doc != "" {
+		config.ErrorDocument.Key = doc
+	}
+	if config.IndexDocument.Suffix == "" {
+		config.IndexDocument.Suffix = "index.html"
+	}
+	return config, nil
+}
+
+// readWebsiteConfig 从存储桶配置文件或网站配置XML文件读取配置
+func readWebsiteConfig(file string) (oossdk.WebsiteConfiguration, error) {
+	if strings.EqualFold(filepath.Ext(file), ".toml") {
+		conf, err := loadBucketConfig(file)
+		if err != nil || conf.Website == nil {
+			return oossdk.WebsiteConfiguration{}, err
+		}
+		return conf.Website.toSDK(), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return oossdk.WebsiteConfiguration{}, err
+	}
+	var website oossdk.GetBucketWebsiteResult
+	if err = xml.Unmarshal(data, &website); err != nil {
+		return oossdk.WebsiteConfiguration{}, fmt.Errorf("网站配置格式错误: %v", err)
+	}
+	if c := newWebsiteConfig(website); c != nil {
+		return c.toSDK(), nil
+	}
+	return oossdk.WebsiteConfiguration{}, nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests 输出每个请求的方法、路径、状态码及跳转地址
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(rec, r)
+		if location := w.Header().Get(oossdk.HTTPHeaderLocation); location != "" {
+			fmt.Println(r.Method, r.URL.Path, rec.status, "->", location)
+			return
+		}
+		fmt.Println(r.Method, r.URL.Path, rec.status)
+	})
+}